@@ -1,22 +1,34 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/zone/IStyle/config"
+	"github.com/zone/IStyle/internal/blob"
+	"github.com/zone/IStyle/internal/collection"
+	"github.com/zone/IStyle/internal/comment"
 	"github.com/zone/IStyle/internal/explore"
 	"github.com/zone/IStyle/internal/feed"
 	"github.com/zone/IStyle/internal/middleware"
 	"github.com/zone/IStyle/internal/search"
+	"github.com/zone/IStyle/internal/security"
 	"github.com/zone/IStyle/internal/storage"
 	"github.com/zone/IStyle/internal/style"
 	"github.com/zone/IStyle/internal/tag"
 	"github.com/zone/IStyle/internal/user"
+	"github.com/zone/IStyle/pkg/blobstore"
+	"github.com/zone/IStyle/pkg/jwtclaim"
+	"github.com/zone/IStyle/pkg/notifier"
+	"github.com/zone/IStyle/pkg/oidc"
+	"github.com/zone/IStyle/pkg/password"
 	"github.com/zone/IStyle/pkg/shutdown"
 )
 
@@ -70,7 +82,59 @@ func buildServer(env config.EnvVars) (*fiber.App, func(), error) {
 		return nil, nil, err
 	}
 
-	app := fiber.New()
+	keys, err := jwtclaim.LoadKeySet(env.JWT_KEYS_FILE, env.JWT_SECRET)
+	if err != nil {
+		return nil, nil, err
+	}
+	jwtclaim.SetKeySet(keys)
+
+	notify, err := buildNotifier(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifier, err := oidc.LoadVerifier(env.OIDC_CONFIG_FILE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passwordPolicy, err := password.LoadPolicy(env.PASSWORD_MIN_LEN, env.PASSWORD_CLASSES, env.BREACHED_PW_FILE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// login links are built from it on every request
+	if link, err := url.Parse(env.LOGIN_LINK_URL); err != nil || !link.IsAbs() {
+		return nil, nil, errors.New("LOGIN_LINK_URL must be an absolute url")
+	}
+
+	blobs, localBlobs, err := buildBlobStore(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appConfig := fiber.Config{}
+	if env.PROXY_HEADER != "" {
+		// the client ip, which login throttling is keyed on, is only taken
+		// from the header when the request comes from one of the proxies.
+		// The proxy has to set the header itself, e.g. X-Real-IP, as the
+		// first address of a forwarded list is whatever the client sent.
+		if env.TRUSTED_PROXIES == "" {
+			return nil, nil, errors.New("TRUSTED_PROXIES is required with PROXY_HEADER")
+		}
+		appConfig.ProxyHeader = env.PROXY_HEADER
+		appConfig.EnableTrustedProxyCheck = true
+		appConfig.EnableIPValidation = true
+		for _, proxy := range strings.Split(env.TRUSTED_PROXIES, ",") {
+			appConfig.TrustedProxies = append(appConfig.TrustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+	if localBlobs != nil {
+		// uploads go through the app itself when blobs are kept on disk
+		appConfig.BodyLimit = localUploadLimit
+	}
+
+	app := fiber.New(appConfig)
 	app.Use(cors.New())
 	app.Use(logger.New())
 
@@ -79,17 +143,21 @@ func buildServer(env config.EnvVars) (*fiber.App, func(), error) {
 	})
 	// create the middleware domain
 	middlewareStore := middleware.NewMiddlewareStorage(db, env.NEO4jDB_NAME)
-	appMiddleware := middleware.NewAuthMiddleware(middlewareStore)
+	securityStore := security.NewSecurityStorage(db, env.NEO4jDB_NAME)
+	appMiddleware := middleware.NewAuthMiddleware(middlewareStore, securityStore)
 
 	// user domain
-	userStore := user.NewUserStorage(db, env.NEO4jDB_NAME)
-	userController := user.NewUserController(userStore)
+	userStore := user.NewUserStorage(db, env.NEO4jDB_NAME, notify, passwordPolicy, env.LOGIN_LINK_URL)
+	userController := user.NewUserController(userStore, verifier, securityStore, blobs)
 	user.AddUserRoutes(app, appMiddleware, userController)
+	stopPurger := user.StartAccountPurger(userStore, time.Hour)
 
 	// style domain
-	styleStore := style.NewStyleStorage(db, env.NEO4jDB_NAME)
-	styleController := style.NewStyleController(styleStore)
+	styleStore := style.NewStyleStorage(db, env.NEO4jDB_NAME, blobs)
+	styleController := style.NewStyleController(styleStore, blobs)
 	style.AddStyleRoutes(app, appMiddleware, styleController)
+	stopProcessor := style.StartImageProcessor(styleStore, 10*time.Second)
+	stopVideoProcessor := style.StartVideoProcessor(styleStore, 30*time.Second)
 
 	// tag domain * TODO (Relocate to separate server)
 	tagStore := tag.NewTagStorage(db, env.NEO4jDB_NAME)
@@ -97,21 +165,126 @@ func buildServer(env config.EnvVars) (*fiber.App, func(), error) {
 	tag.AddTagRoutes(app, appMiddleware, tagController)
 
 	// feed domain
-	feedStore := feed.NewFeedStorage(db, env.NEO4jDB_NAME)
+	feedStore := feed.NewFeedStorage(db, env.NEO4jDB_NAME, blobs)
 	feedController := feed.NewFeedController(feedStore)
 	feed.AddFeedRoutes(app, appMiddleware, feedController)
 
 	// search domain
-	searchStore := search.NewSearchStorage(db, env.NEO4jDB_NAME)
+	searchStore := search.NewSearchStorage(db, env.NEO4jDB_NAME, blobs)
 	searchController := search.NewSearchController(searchStore)
 	search.AddSearchRoutes(app, appMiddleware, searchController)
 
 	// explore domain
-	exploreStore := explore.NewExploreStorage(db, env.NEO4jDB_NAME)
+	exploreStore := explore.NewExploreStorage(db, env.NEO4jDB_NAME, blobs)
 	exploreController := explore.NewFeedController(exploreStore)
 	explore.AddExploreRoutes(app, appMiddleware, exploreController)
 
+	// collection domain
+	collectionStore := collection.NewCollectionStorage(db, env.NEO4jDB_NAME, blobs)
+	collectionController := collection.NewCollectionController(collectionStore)
+	collection.AddCollectionRoutes(app, appMiddleware, collectionController)
+
+	// comment domain
+	commentStore := comment.NewCommentStorage(db, env.NEO4jDB_NAME)
+	commentController := comment.NewCommentController(commentStore)
+	comment.AddCommentRoutes(app, appMiddleware, commentController)
+
+	// blob domain
+	if localBlobs != nil {
+		blobController := blob.NewBlobController(localBlobs)
+		blob.AddBlobRoutes(app, blobController)
+	}
+	blobStore := blob.NewBlobStorage(db, env.NEO4jDB_NAME)
+	stopReaper := blob.StartBlobReaper(blobStore, blobs, 10*time.Minute)
+
 	return app, func() {
+		stopReaper()
+		stopProcessor()
+		stopVideoProcessor()
+		stopPurger()
 		storage.CloseNeo4j(db)
 	}, nil
 }
+
+// localUploadLimit is the largest request body accepted while uploads are
+// served by the local blob store.
+const localUploadLimit = 64 << 20
+
+// buildBlobStore returns the configured blob store, and the same store as a
+// *blobstore.LocalStore when it has to be served by the app.
+func buildBlobStore(env config.EnvVars) (blobstore.BlobStore, *blobstore.LocalStore, error) {
+	switch env.BLOB_STORE {
+	case "", "s3":
+		region := env.S3_REGION
+		if region == "" {
+			region = "eu-north-1"
+		}
+		store, err := blobstore.NewS3Store(region, env.S3_ENDPOINT, env.S3_BUCKET, env.S3_ACCESS_KEY, env.S3_SECRET_KEY)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, nil, nil
+	case "local":
+		store, err := blobstore.NewLocalStore(env.BLOB_DIR, env.BLOB_URL, env.BLOB_SECRET)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store, nil
+	default:
+		return nil, nil, errors.New("unknown BLOB_STORE " + env.BLOB_STORE)
+	}
+}
+
+func buildNotifier(env config.EnvVars) (*notifier.Dispatcher, error) {
+	var email notifier.Notifier
+	var sms notifier.Notifier
+
+	// default to the file sink so local setups work without any provider
+	var fileNotifier *notifier.FileNotifier
+	fileSink := func() (*notifier.FileNotifier, error) {
+		if fileNotifier != nil {
+			return fileNotifier, nil
+		}
+		var err error
+		fileNotifier, err = notifier.NewFileNotifier(env.NOTIFIER_FILE)
+		return fileNotifier, err
+	}
+
+	switch env.EMAIL_NOTIFIER {
+	case "smtp":
+		if env.SMTP_HOST == "" || env.SMTP_FROM == "" {
+			return nil, errors.New("SMTP_HOST and SMTP_FROM are required")
+		}
+		port := env.SMTP_PORT
+		if port == "" {
+			port = "587"
+		}
+		email = notifier.NewSMTPNotifier(env.SMTP_HOST, port, env.SMTP_USERNAME, env.SMTP_PASSWORD, env.SMTP_FROM)
+	case "", "file":
+		sink, err := fileSink()
+		if err != nil {
+			return nil, err
+		}
+		email = sink
+	default:
+		return nil, errors.New("unknown EMAIL_NOTIFIER " + env.EMAIL_NOTIFIER)
+	}
+
+	switch env.SMS_NOTIFIER {
+	case "http":
+		if env.SMS_API_URL == "" {
+			return nil, errors.New("SMS_API_URL is required")
+		}
+		sms = notifier.NewSMSNotifier(env.SMS_API_URL, env.SMS_API_KEY, env.SMS_SENDER)
+	case "", "file":
+		sink, err := fileSink()
+		if err != nil {
+			return nil, err
+		}
+		sms = sink
+	default:
+		return nil, errors.New("unknown SMS_NOTIFIER " + env.SMS_NOTIFIER)
+	}
+
+	return notifier.NewDispatcher(email, sms), nil
+}
@@ -16,6 +16,32 @@ type EnvVars struct {
 	S3_ACCESS_KEY    string `mapstructure:"S3_ACCESS_KEY"`
 	S3_SECRET_KEY    string `mapstructure:"S3_SECRET_KEY"`
 	S3_BUCKET        string `mapstructure:"S3_BUCKET"`
+	S3_REGION        string `mapstructure:"S3_REGION"`
+	S3_ENDPOINT      string `mapstructure:"S3_ENDPOINT"`
+	BLOB_STORE       string `mapstructure:"BLOB_STORE"`
+	BLOB_DIR         string `mapstructure:"BLOB_DIR"`
+	BLOB_URL         string `mapstructure:"BLOB_URL"`
+	BLOB_SECRET      string `mapstructure:"BLOB_SECRET"`
+	EMAIL_NOTIFIER   string `mapstructure:"EMAIL_NOTIFIER"`
+	SMS_NOTIFIER     string `mapstructure:"SMS_NOTIFIER"`
+	NOTIFIER_FILE    string `mapstructure:"NOTIFIER_FILE"`
+	SMTP_HOST        string `mapstructure:"SMTP_HOST"`
+	SMTP_PORT        string `mapstructure:"SMTP_PORT"`
+	SMTP_USERNAME    string `mapstructure:"SMTP_USERNAME"`
+	SMTP_PASSWORD    string `mapstructure:"SMTP_PASSWORD"`
+	SMTP_FROM        string `mapstructure:"SMTP_FROM"`
+	SMS_API_URL      string `mapstructure:"SMS_API_URL"`
+	SMS_API_KEY      string `mapstructure:"SMS_API_KEY"`
+	SMS_SENDER       string `mapstructure:"SMS_SENDER"`
+	JWT_KEYS_FILE    string `mapstructure:"JWT_KEYS_FILE"`
+	JWT_SECRET       string `mapstructure:"JWT_SECRET"`
+	OIDC_CONFIG_FILE string `mapstructure:"OIDC_CONFIG_FILE"`
+	PASSWORD_MIN_LEN string `mapstructure:"PASSWORD_MIN_LEN"`
+	PASSWORD_CLASSES string `mapstructure:"PASSWORD_CLASSES"`
+	BREACHED_PW_FILE string `mapstructure:"BREACHED_PW_FILE"`
+	LOGIN_LINK_URL   string `mapstructure:"LOGIN_LINK_URL"`
+	PROXY_HEADER     string `mapstructure:"PROXY_HEADER"`
+	TRUSTED_PROXIES  string `mapstructure:"TRUSTED_PROXIES"`
 }
 
 func LoadConfig() (config EnvVars, err error) {
@@ -27,6 +53,35 @@ func LoadConfig() (config EnvVars, err error) {
 			NEO4jDB_USER:     os.Getenv("NEO4jDB_USER"),
 			NEO4jDB_Password: os.Getenv("NEO4jDB_Password"),
 			PORT:             os.Getenv("PORT"),
+			S3_ACCESS_KEY:    os.Getenv("S3_ACCESS_KEY"),
+			S3_SECRET_KEY:    os.Getenv("S3_SECRET_KEY"),
+			S3_BUCKET:        os.Getenv("S3_BUCKET"),
+			S3_REGION:        os.Getenv("S3_REGION"),
+			S3_ENDPOINT:      os.Getenv("S3_ENDPOINT"),
+			BLOB_STORE:       os.Getenv("BLOB_STORE"),
+			BLOB_DIR:         os.Getenv("BLOB_DIR"),
+			BLOB_URL:         os.Getenv("BLOB_URL"),
+			BLOB_SECRET:      os.Getenv("BLOB_SECRET"),
+			EMAIL_NOTIFIER:   os.Getenv("EMAIL_NOTIFIER"),
+			SMS_NOTIFIER:     os.Getenv("SMS_NOTIFIER"),
+			NOTIFIER_FILE:    os.Getenv("NOTIFIER_FILE"),
+			SMTP_HOST:        os.Getenv("SMTP_HOST"),
+			SMTP_PORT:        os.Getenv("SMTP_PORT"),
+			SMTP_USERNAME:    os.Getenv("SMTP_USERNAME"),
+			SMTP_PASSWORD:    os.Getenv("SMTP_PASSWORD"),
+			SMTP_FROM:        os.Getenv("SMTP_FROM"),
+			SMS_API_URL:      os.Getenv("SMS_API_URL"),
+			SMS_API_KEY:      os.Getenv("SMS_API_KEY"),
+			SMS_SENDER:       os.Getenv("SMS_SENDER"),
+			JWT_KEYS_FILE:    os.Getenv("JWT_KEYS_FILE"),
+			JWT_SECRET:       os.Getenv("JWT_SECRET"),
+			OIDC_CONFIG_FILE: os.Getenv("OIDC_CONFIG_FILE"),
+			PASSWORD_MIN_LEN: os.Getenv("PASSWORD_MIN_LEN"),
+			PASSWORD_CLASSES: os.Getenv("PASSWORD_CLASSES"),
+			BREACHED_PW_FILE: os.Getenv("BREACHED_PW_FILE"),
+			LOGIN_LINK_URL:   os.Getenv("LOGIN_LINK_URL"),
+			PROXY_HEADER:     os.Getenv("PROXY_HEADER"),
+			TRUSTED_PROXIES:  os.Getenv("TRUSTED_PROXIES"),
 		}, nil
 	}
 
@@ -0,0 +1,99 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zone/IStyle/pkg/blobstore"
+)
+
+// BlobController serves the presigned urls of a local blob store, standing
+// in for S3 during development and tests.
+type BlobController struct {
+	store *blobstore.LocalStore
+}
+
+func NewBlobController(store *blobstore.LocalStore) *BlobController {
+	return &BlobController{
+		store: store,
+	}
+}
+
+func (b *BlobController) putObject(c *fiber.Ctx) error {
+	key := c.Params("key")
+
+	if c.Query("uploadId") != "" {
+		return b.putPart(c, key)
+	}
+
+	err := b.store.Verify(fiber.MethodPut, key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	err = b.store.Write(key, c.Get(fiber.HeaderContentType), bytes.NewReader(c.Body()))
+	if errors.Is(err, blobstore.ErrInvalidKey) {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("something went wrong")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// putPart stores a part of a multipart upload and answers with its ETag,
+// like S3 does.
+func (b *BlobController) putPart(c *fiber.Ctx, key string) error {
+	uploadId := c.Query("uploadId")
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil || partNumber < 1 {
+		return c.Status(fiber.StatusBadRequest).SendString(blobstore.ErrInvalidPart.Error())
+	}
+
+	err = b.store.VerifyPart(key, uploadId, partNumber, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	etag, err := b.store.WritePart(key, uploadId, partNumber, bytes.NewReader(c.Body()))
+	if errors.Is(err, blobstore.ErrInvalidUploadId) {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("something went wrong")
+	}
+
+	c.Set(fiber.HeaderETag, etag)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (b *BlobController) getObject(c *fiber.Ctx) error {
+	key := c.Params("key")
+
+	err := b.store.Verify(fiber.MethodGet, key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	object, err := b.store.Head(c.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("something went wrong")
+	}
+
+	file, err := b.store.Open(key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("something went wrong")
+	}
+
+	if object.ContentType != "" {
+		c.Set(fiber.HeaderContentType, object.ContentType)
+	}
+	// the response closes the file once it is sent
+	return c.SendStream(file, int(object.Size))
+}
@@ -0,0 +1,81 @@
+package blob
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zone/IStyle/pkg/blobstore"
+	"github.com/zone/IStyle/pkg/imaging"
+	"github.com/zone/IStyle/pkg/video"
+)
+
+// deletionBatch is how many objects are deleted per run.
+const deletionBatch = 100
+
+// StartBlobReaper periodically deletes the objects queued for deletion,
+// including uploads that were never used. The returned function stops it.
+func StartBlobReaper(storage *BlobStorage, store blobstore.BlobStore, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := storage.expireUploads(ctx); err != nil {
+					log.Printf("expiring uploads failed: %v", err)
+				}
+
+				deletions, err := storage.pendingDeletions(deletionBatch, ctx)
+				if err != nil {
+					log.Printf("loading blob deletions failed: %v", err)
+					continue
+				}
+
+				deleted := 0
+				for _, deletion := range deletions {
+					// failed keys stay queued and are retried on the next run
+					if err := deleteBlob(store, deletion, ctx); err != nil {
+						log.Printf("deleting blob %s failed: %v", deletion.key, err)
+						continue
+					}
+					if err := storage.completeDeletion(deletion.key, ctx); err != nil {
+						log.Printf("completing blob deletion %s failed: %v", deletion.key, err)
+						continue
+					}
+					deleted++
+				}
+				if deleted > 0 {
+					log.Printf("deleted %d blobs", deleted)
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// deleteBlob discards the unfinished multipart uploads of a key and deletes
+// it along with the copies the media pipelines made of it.
+func deleteBlob(store blobstore.BlobStore, deletion pendingDeletion, ctx context.Context) error {
+	for _, uploadId := range deletion.uploadIds {
+		if err := store.AbortMultipart(ctx, deletion.key, uploadId); err != nil {
+			return err
+		}
+	}
+
+	poster := video.PosterKey(deletion.key)
+	keys := append(imaging.VariantKeys(deletion.key), imaging.VariantKeys(poster)...)
+	keys = append(keys, poster, deletion.key)
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package blob
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// AddBlobRoutes mounts the local blob store. The presigned url is the only
+// authorisation, so the routes sit outside of /auth.
+func AddBlobRoutes(app *fiber.App, controller *BlobController) {
+	blobs := app.Group("/blobs")
+
+	blobs.Put("/:key", controller.putObject)
+	blobs.Get("/:key", controller.getObject)
+}
@@ -0,0 +1,120 @@
+package blob
+
+import (
+	"context"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+type BlobStorage struct {
+	db     neo4j.DriverWithContext
+	dbName string
+}
+
+func NewBlobStorage(db neo4j.DriverWithContext, dbName string) *BlobStorage {
+	return &BlobStorage{
+		db:     db,
+		dbName: dbName,
+	}
+}
+
+// expireUploads queues the objects of upload keys that expired without
+// being used for a style. Multipart uploads that were never completed keep
+// their upload id so the parts can be discarded.
+func (b *BlobStorage) expireUploads(ctx context.Context) error {
+	session := b.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: b.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (up:Upload)
+         WHERE up.expires_at < datetime($now)
+         WITH up LIMIT 100
+         CREATE (:BlobDeletion {key:up.key, upload_id:up.upload_id, requested_at:datetime($now)})
+         DETACH DELETE up`,
+				map[string]interface{}{
+					"now": time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+
+	return err
+}
+
+type pendingDeletion struct {
+	key string
+	// uploadIds are the multipart uploads to abort for key
+	uploadIds []string
+}
+
+// pendingDeletions returns up to limit keys, oldest first, that are queued
+// for deletion.
+func (b *BlobStorage) pendingDeletions(limit int, ctx context.Context) ([]pendingDeletion, error) {
+	session := b.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: b.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	keys, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (d:BlobDeletion)
+         WITH d.key AS key, min(d.requested_at) AS requestedAt, collect(DISTINCT d.upload_id) AS uploadIds
+         RETURN key, uploadIds ORDER BY requestedAt LIMIT $limit`,
+				map[string]interface{}{
+					"limit": limit,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			records, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			var deletions []pendingDeletion
+			for _, record := range records {
+				key, _ := record.Get("key")
+				uploadIds, _ := record.Get("uploadIds")
+
+				k, ok := key.(string)
+				if !ok {
+					continue
+				}
+				deletion := pendingDeletion{key: k}
+				list, _ := uploadIds.([]interface{})
+				for _, id := range list {
+					if uploadId, ok := id.(string); ok {
+						deletion.uploadIds = append(deletion.uploadIds, uploadId)
+					}
+				}
+				deletions = append(deletions, deletion)
+			}
+			return deletions, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.([]pendingDeletion), nil
+}
+
+// completeDeletion takes key off the deletion queue.
+func (b *BlobStorage) completeDeletion(key string, ctx context.Context) error {
+	session := b.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: b.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (d:BlobDeletion {key:$key}) DELETE d",
+				map[string]interface{}{
+					"key": key,
+				},
+			)
+		})
+
+	return err
+}
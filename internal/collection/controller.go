@@ -0,0 +1,511 @@
+package collection
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CollectionController struct {
+	storage *CollectionStorage
+}
+
+func NewCollectionController(storage *CollectionStorage) *CollectionController {
+	return &CollectionController{
+		storage: storage,
+	}
+}
+
+var validate = validator.New()
+
+// collectionErrorStatus maps the errors of the collection storage to the
+// status they are answered with.
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errCollectionNotFound), errors.Is(err, errStyleNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, errNotCollectionOwner):
+		return fiber.StatusForbidden
+	case errors.Is(err, errDefaultCollection), errors.Is(err, errStyleNotInCollection):
+		return fiber.StatusBadRequest
+	default:
+		return 0
+	}
+}
+
+type createCollectionRequest struct {
+	Name      string `json:"name" validate:"required,max=50"`
+	IsPrivate bool   `json:"isPrivate"`
+}
+
+type createCollectionData struct {
+	Id string `json:"id"`
+}
+
+type createCollectionResponse struct {
+	Data    *createCollectionData `json:"data"`
+	Message string                `json:"message"`
+	Success bool                  `json:"success"`
+}
+
+func (cc *CollectionController) createCollection(c *fiber.Ctx) error {
+	var req createCollectionRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(createCollectionResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	id, err := cc.storage.create(userName, req.Name, req.IsPrivate, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(createCollectionResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(createCollectionResponse{
+		Data:    &createCollectionData{Id: id},
+		Message: "created successfully",
+		Success: true,
+	})
+}
+
+type getCollectionsResponse struct {
+	Data    []collection `json:"data"`
+	Message string       `json:"message"`
+	Success bool         `json:"success"`
+}
+
+func (cc *CollectionController) getCollections(c *fiber.Ctx) error {
+	cursor := c.Query("cursor")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	result, err := cc.storage.collections(userName, userName, cursor, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCollectionsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCollectionsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+func (cc *CollectionController) getCollectionsByUserName(c *fiber.Ctx) error {
+	cursor := c.Query("cursor")
+	userName := c.Params("userName")
+
+	loggedInUser, _ := c.Locals("userName").(string)
+
+	result, err := cc.storage.collections(userName, loggedInUser, cursor, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCollectionsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCollectionsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type getCollectionResponse struct {
+	Data    *collection `json:"data"`
+	Message string      `json:"message"`
+	Success bool        `json:"success"`
+}
+
+func (cc *CollectionController) getCollection(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	loggedInUser, _ := c.Locals("userName").(string)
+
+	result, err := cc.storage.collectionById(loggedInUser, id, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(getCollectionResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCollectionResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCollectionResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+// updateCollectionRequest fields that are left out are not changed, an
+// empty cover goes back to the first style of the collection.
+type updateCollectionRequest struct {
+	Name      *string `json:"name" validate:"omitempty,min=1,max=50"`
+	IsPrivate *bool   `json:"isPrivate"`
+	Cover     *string `json:"cover"`
+}
+type updateCollectionResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (cc *CollectionController) updateCollection(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req updateCollectionRequest
+	if err := c.BodyParser(&req); err != nil || id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(updateCollectionResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateCollectionResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.update(userName, id, req.Name, req.IsPrivate, req.Cover, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(updateCollectionResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateCollectionResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updateCollectionResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type deleteCollectionResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (cc *CollectionController) deleteCollection(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.delete(userName, id, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(deleteCollectionResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteCollectionResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deleteCollectionResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type getCollectionStylesResponse struct {
+	Data    []collectionStyle `json:"data"`
+	Message string            `json:"message"`
+	Success bool              `json:"success"`
+}
+
+// getCollectionStyles pages through a collection, cursor is the position of
+// the last style that was returned.
+func (cc *CollectionController) getCollectionStyles(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var cursor *int
+	if c.Query("cursor") != "" {
+		position, err := strconv.Atoi(c.Query("cursor"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(getCollectionStylesResponse{
+				Message: "Invalid cursor",
+				Success: false,
+			})
+		}
+		cursor = &position
+	}
+
+	loggedInUser, _ := c.Locals("userName").(string)
+
+	result, err := cc.storage.collectionStyles(loggedInUser, id, cursor, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(getCollectionStylesResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCollectionStylesResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCollectionStylesResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type collectionStyleRequest struct {
+	StyleId string `json:"styleId" validate:"required"`
+}
+type collectionStyleResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (cc *CollectionController) addStyle(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req collectionStyleRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.addStyle(userName, id, req.StyleId, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(collectionStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(collectionStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (cc *CollectionController) removeStyle(c *fiber.Ctx) error {
+	id := c.Params("id")
+	styleId := c.Params("styleId")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.removeStyle(userName, id, styleId, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(collectionStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(collectionStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type moveStyleRequest struct {
+	Position int `json:"position" validate:"min=0"`
+}
+
+func (cc *CollectionController) moveStyle(c *fiber.Ctx) error {
+	id := c.Params("id")
+	styleId := c.Params("styleId")
+
+	var req moveStyleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.moveStyle(userName, id, styleId, req.Position, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(collectionStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(collectionStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (cc *CollectionController) saveStyle(c *fiber.Ctx) error {
+	var req collectionStyleRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.save(userName, req.StyleId, c.Context())
+	if status := collectionErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(collectionStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(collectionStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (cc *CollectionController) unsaveStyle(c *fiber.Ctx) error {
+	var req collectionStyleRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.unsave(userName, req.StyleId, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(collectionStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(collectionStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
@@ -0,0 +1,27 @@
+package collection
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/zone/IStyle/internal/middleware"
+)
+
+func AddCollectionRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, controller *CollectionController) {
+	auth := app.Group("/auth")
+
+	collection := auth.Group("/collection", middleware.VerifyUser)
+	collection.Get("/", controller.getCollections)
+	collection.Post("/", controller.createCollection)
+	collection.Post("/save", controller.saveStyle)
+	collection.Post("/unsave", controller.unsaveStyle)
+
+	collectionByUserName := collection.Group("/user/:userName", middleware.CheckUserNameExists, middleware.CheckNotBlocked, middleware.CanViewProfile)
+	collectionByUserName.Get("/", controller.getCollectionsByUserName)
+
+	collection.Get("/:id", controller.getCollection)
+	collection.Patch("/:id", controller.updateCollection)
+	collection.Delete("/:id", controller.deleteCollection)
+	collection.Get("/:id/styles", controller.getCollectionStyles)
+	collection.Post("/:id/styles", controller.addStyle)
+	collection.Delete("/:id/styles/:styleId", controller.removeStyle)
+	collection.Post("/:id/styles/:styleId/move", controller.moveStyle)
+}
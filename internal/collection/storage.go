@@ -0,0 +1,699 @@
+package collection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
+)
+
+type CollectionStorage struct {
+	db     neo4j.DriverWithContext
+	dbName string
+	blobs  blobstore.BlobStore
+}
+
+func NewCollectionStorage(db neo4j.DriverWithContext, dbName string, blobs blobstore.BlobStore) *CollectionStorage {
+	return &CollectionStorage{
+		db:     db,
+		dbName: dbName,
+		blobs:  blobs,
+	}
+}
+
+const (
+	// defaultCollectionName is the name of the board styles are saved to
+	// when no collection is picked.
+	defaultCollectionName = "Saved"
+	collectionPageSize    = 30
+)
+
+var (
+	errCollectionNotFound   = errors.New("collection does not exist")
+	errNotCollectionOwner   = errors.New("only the owner can change this collection")
+	errDefaultCollection    = errors.New("the default collection can't be deleted")
+	errStyleNotFound        = errors.New("style does not exist")
+	errStyleNotInCollection = errors.New("style is not in this collection")
+	errInvalidCursor        = errors.New("invalid cursor")
+)
+
+// parseCursor splits a cursor into the created_at and the id of the last
+// collection of the previous page. The id breaks ties between collections
+// created within the same second.
+func parseCursor(cursor string) (string, string, error) {
+	if cursor == "" {
+		return "", "", nil
+	}
+
+	createdAt, id, ok := strings.Cut(cursor, ",")
+	if !ok || id == "" {
+		return "", "", errInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339, createdAt); err != nil {
+		return "", "", errInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+type collection struct {
+	Id         string         `json:"id"`
+	Name       string         `json:"name"`
+	Cover      string         `json:"cover"`
+	IsPrivate  bool           `json:"isPrivate"`
+	IsDefault  bool           `json:"isDefault"`
+	StyleCount int            `json:"styleCount"`
+	Owner      collectionUser `json:"owner"`
+	Created_at string         `json:"created_at"`
+	// Cursor is passed back to get the page after this collection
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type collectionUser struct {
+	UserName   string `json:"userName"`
+	ProfilePic string `json:"profilePic"`
+}
+
+type collectionStyle struct {
+	Id        string         `json:"id"`
+	Image     string         `json:"image"`
+	MediaType string         `json:"mediaType"`
+	Media     models.Gallery `json:"media"`
+	User      collectionUser `json:"user"`
+	Position  int            `json:"position"`
+	Saved_at  string         `json:"saved_at"`
+}
+
+// create adds an empty collection for userName and returns its id.
+func (c *CollectionStorage) create(userName string, name string, isPrivate bool, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	id, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         CREATE (c:Collection {uuid:randomUUID(), name:$name, isPrivate:$isPrivate, isDefault:false, created_at:datetime($now), updated_at:datetime($now)})-[:OWNED_BY]->(u)
+         RETURN c.uuid AS id`,
+				map[string]interface{}{
+					"userName":  userName,
+					"name":      name,
+					"isPrivate": isPrivate,
+					"now":       time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			id, _ := record.Get("id")
+			return id, nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return id.(string), nil
+}
+
+// defaultCollection returns the id of the "Saved" board of userName, which
+// is created the first time it is needed.
+func defaultCollection(tx neo4j.ManagedTransaction, userName string, ctx context.Context) (string, error) {
+	now := time.Now().Format(time.RFC3339)
+	result, err := tx.Run(ctx,
+		`MATCH (u:User {userName:$userName})
+     MERGE (c:Collection {isDefault:true})-[:OWNED_BY]->(u)
+     ON CREATE SET c.uuid=randomUUID(), c.name=$name, c.isPrivate=true, c.created_at=datetime($now), c.updated_at=datetime($now)
+     RETURN c.uuid AS id`,
+		map[string]interface{}{
+			"userName": userName,
+			"name":     defaultCollectionName,
+			"now":      now,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return "", err
+	}
+	id, _ := record.Get("id")
+	return id.(string), nil
+}
+
+// collectionOwner returns the userName of the owner of the collection, or
+// an empty string when the collection does not exist.
+func collectionOwner(tx neo4j.ManagedTransaction, id string, ctx context.Context) (string, bool, error) {
+	result, err := tx.Run(ctx,
+		"MATCH (c:Collection {uuid:$id})-[:OWNED_BY]->(u:User) RETURN u.userName AS owner, coalesce(c.isDefault, false) AS isDefault",
+		map[string]interface{}{
+			"id": id,
+		},
+	)
+	if err != nil {
+		return "", false, err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil || len(records) == 0 {
+		return "", false, err
+	}
+	owner, _ := records[0].Get("owner")
+	isDefault, _ := records[0].Get("isDefault")
+	userName, _ := owner.(string)
+	return userName, isDefault == true, nil
+}
+
+// update changes the parts of a collection that are not nil. An empty
+// cover goes back to the first style of the collection.
+func (c *CollectionStorage) update(userName string, id string, name *string, isPrivate *bool, cover *string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// ownership errors are returned as the result, not as a failure
+			owner, _, err := collectionOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errCollectionNotFound, nil
+			}
+			if owner != userName {
+				return errNotCollectionOwner, nil
+			}
+
+			params := map[string]interface{}{
+				"id":  id,
+				"now": time.Now().Format(time.RFC3339),
+			}
+			query := "MATCH (c:Collection {uuid:$id}) SET c.updated_at=datetime($now)"
+			if name != nil {
+				params["name"] = *name
+				query += ", c.name=$name"
+			}
+			if isPrivate != nil {
+				params["isPrivate"] = *isPrivate
+				query += ", c.isPrivate=$isPrivate"
+			}
+			if _, err := tx.Run(ctx, query, params); err != nil {
+				return nil, err
+			}
+
+			if cover != nil {
+				result, err := tx.Run(ctx,
+					`MATCH (c:Collection {uuid:$id})
+           OPTIONAL MATCH (c)-[old:COVER]->(:Style)
+           DELETE old
+           WITH DISTINCT c
+           OPTIONAL MATCH (s:Style {uuid:$cover})-[:SAVED_IN]->(c)
+           FOREACH (style IN CASE WHEN s IS NULL THEN [] ELSE [s] END | CREATE (c)-[:COVER]->(style))
+           RETURN s IS NOT NULL AS isSet`,
+					map[string]interface{}{
+						"id":    id,
+						"cover": *cover,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+				record, err := result.Single(ctx)
+				if err != nil {
+					return nil, err
+				}
+				isSet, _ := record.Get("isSet")
+				if *cover != "" && isSet != true {
+					// roll back, the previous cover stays
+					return nil, errStyleNotInCollection
+				}
+			}
+
+			return nil, nil
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "updated successfully", nil
+}
+
+// delete removes a collection, the styles in it are left untouched.
+func (c *CollectionStorage) delete(userName string, id string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			owner, isDefault, err := collectionOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errCollectionNotFound, nil
+			}
+			if owner != userName {
+				return errNotCollectionOwner, nil
+			}
+			if isDefault {
+				return errDefaultCollection, nil
+			}
+
+			return tx.Run(ctx,
+				"MATCH (c:Collection {uuid:$id}) DETACH DELETE c",
+				map[string]interface{}{
+					"id": id,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "deleted successfully", nil
+}
+
+// collections lists the collections of owner that loggedInUser can see,
+// the default board first and then the newest. cursor is the cursor of the
+// last collection of the previous page.
+func (c *CollectionStorage) collections(owner string, loggedInUser string, cursor string, ctx context.Context) ([]collection, error) {
+	cursorAt, cursorId, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	records, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// the owner always sees the default board, even before saving
+			if owner == loggedInUser {
+				if _, err := defaultCollection(tx, owner, ctx); err != nil {
+					return nil, err
+				}
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (c:Collection)-[:OWNED_BY]->(o:User {userName:$owner})
+         WHERE ($owner = $userName OR NOT c.isPrivate)
+         AND ($cursorAt = "" OR (NOT c.isDefault AND (c.created_at < datetime($cursorAt) OR (c.created_at = datetime($cursorAt) AND c.uuid < $cursorId))))
+         WITH c, o ORDER BY c.isDefault DESC, c.created_at DESC, c.uuid DESC LIMIT $limit
+         CALL {
+           WITH c
+           OPTIONAL MATCH (s:Style)-[r:SAVED_IN]->(c)
+           OPTIONAL MATCH (s)-[:CREATED_BY]->(p:User)
+           WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+           AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+           WITH s, r, p ORDER BY r.position
+           RETURN count(p) AS styleCount, head(collect(CASE WHEN p IS NULL THEN null ELSE s.image END)) AS firstImage
+         }
+         OPTIONAL MATCH (c)-[:COVER]->(cs:Style)
+         RETURN c.uuid AS id, c.name AS name, coalesce(cs.image, firstImage) AS cover, c.isPrivate AS isPrivate, c.isDefault AS isDefault, styleCount,
+         {userName:o.userName, profilePic:o.profilePic} AS owner, toString(c.created_at) AS created_at, toString(c.created_at) + "," + c.uuid AS cursor
+         ORDER BY c.isDefault DESC, c.created_at DESC, c.uuid DESC`,
+				map[string]interface{}{
+					"owner":    owner,
+					"userName": loggedInUser,
+					"cursorAt": cursorAt,
+					"cursorId": cursorId,
+					"limit":    collectionPageSize,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []collection
+	for _, record := range records.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(record.AsMap())
+
+		var structData collection
+		json.Unmarshal(jsonData, &structData)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
+
+// collectionById returns the collection when loggedInUser can see it.
+func (c *CollectionStorage) collectionById(loggedInUser string, id string, ctx context.Context) (*collection, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	records, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (c:Collection {uuid:$id})-[:OWNED_BY]->(o:User)
+         WHERE o.userName = $userName
+         OR (NOT c.isPrivate AND (NOT coalesce(o.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(o)) AND NOT (:User {userName:$userName})-[:BLOCKED]-(o))
+         CALL {
+           WITH c
+           OPTIONAL MATCH (s:Style)-[r:SAVED_IN]->(c)
+           OPTIONAL MATCH (s)-[:CREATED_BY]->(p:User)
+           WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+           AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+           WITH s, r, p ORDER BY r.position
+           RETURN count(p) AS styleCount, head(collect(CASE WHEN p IS NULL THEN null ELSE s.image END)) AS firstImage
+         }
+         OPTIONAL MATCH (c)-[:COVER]->(cs:Style)
+         RETURN c.uuid AS id, c.name AS name, coalesce(cs.image, firstImage) AS cover, c.isPrivate AS isPrivate, c.isDefault AS isDefault, styleCount,
+         {userName:o.userName, profilePic:o.profilePic} AS owner, toString(c.created_at) AS created_at`,
+				map[string]interface{}{
+					"id":       id,
+					"userName": loggedInUser,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list := records.([]*neo4j.Record)
+	if len(list) == 0 {
+		return nil, errCollectionNotFound
+	}
+
+	jsonData, _ := json.Marshal(list[0].AsMap())
+	var structData collection
+	json.Unmarshal(jsonData, &structData)
+
+	return &structData, nil
+}
+
+// collectionStyles returns a page of the styles in a collection in their
+// saved order. cursor is the position of the last style of the previous
+// page, nil for the first page.
+func (c *CollectionStorage) collectionStyles(loggedInUser string, id string, cursor *int, ctx context.Context) ([]collectionStyle, error) {
+	if _, err := c.collectionById(loggedInUser, id, ctx); err != nil {
+		return nil, err
+	}
+
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	var after interface{}
+	if cursor != nil {
+		after = *cursor
+	}
+
+	records, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (c:Collection {uuid:$id})<-[r:SAVED_IN]-(s:Style)-[:CREATED_BY]->(p:User)
+         WHERE ($cursor IS NULL OR r.position > $cursor)
+         AND (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+         AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+         RETURN s.uuid AS id, s.image AS image, coalesce(s.media_type, 'image') AS mediaType,
+         [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media,
+         {userName:p.userName, profilePic:p.profilePic} AS user, r.position AS position, toString(r.saved_at) AS saved_at
+         ORDER BY r.position
+         LIMIT $limit`,
+				map[string]interface{}{
+					"id":       id,
+					"userName": loggedInUser,
+					"cursor":   after,
+					"limit":    collectionPageSize,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []collectionStyle
+	for _, record := range records.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(record.AsMap())
+
+		var structData collectionStyle
+		json.Unmarshal(jsonData, &structData)
+		structData.Media.Prepare(ctx, c.blobs)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
+
+// addStyle saves a style userName can see to the front of the collection.
+// Saving it again leaves its position as it is.
+func addStyle(tx neo4j.ManagedTransaction, userName string, id string, styleId string, ctx context.Context) error {
+	result, err := tx.Run(ctx,
+		`MATCH (c:Collection {uuid:$id})
+     MATCH (s:Style {uuid:$styleId})-[:CREATED_BY]->(p:User)
+     WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+     AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+     OPTIONAL MATCH (:Style)-[other:SAVED_IN]->(c)
+     WITH c, s, min(other.position) AS first
+     MERGE (s)-[r:SAVED_IN]->(c)
+     ON CREATE SET r.position=coalesce(first, 1) - 1, r.saved_at=datetime($now)
+     SET c.updated_at=datetime($now)
+     RETURN count(r) AS saved`,
+		map[string]interface{}{
+			"id":       id,
+			"styleId":  styleId,
+			"userName": userName,
+			"now":      time.Now().Format(time.RFC3339),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+
+	saved, _ := record.Get("saved")
+	if saved != int64(1) {
+		return errStyleNotFound
+	}
+	return nil
+}
+
+func (c *CollectionStorage) addStyle(userName string, id string, styleId string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			owner, _, err := collectionOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errCollectionNotFound, nil
+			}
+			if owner != userName {
+				return errNotCollectionOwner, nil
+			}
+
+			err = addStyle(tx, userName, id, styleId, ctx)
+			if errors.Is(err, errStyleNotFound) {
+				return err, nil
+			}
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "saved successfully", nil
+}
+
+func (c *CollectionStorage) removeStyle(userName string, id string, styleId string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			owner, _, err := collectionOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errCollectionNotFound, nil
+			}
+			if owner != userName {
+				return errNotCollectionOwner, nil
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (c:Collection {uuid:$id})<-[r:SAVED_IN]-(s:Style {uuid:$styleId})
+         OPTIONAL MATCH (c)-[cover:COVER]->(s)
+         DELETE r, cover
+         SET c.updated_at=datetime($now)
+         RETURN count(r) AS removed`,
+				map[string]interface{}{
+					"id":      id,
+					"styleId": styleId,
+					"now":     time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			removed, _ := record.Get("removed")
+			if removed == int64(0) {
+				return errStyleNotInCollection, nil
+			}
+			return nil, nil
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "removed successfully", nil
+}
+
+// moveStyle puts a style at position, counted from 0, and renumbers the
+// rest of the collection. Positions past the end move it to the end.
+func (c *CollectionStorage) moveStyle(userName string, id string, styleId string, position int, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			owner, _, err := collectionOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errCollectionNotFound, nil
+			}
+			if owner != userName {
+				return errNotCollectionOwner, nil
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (c:Collection {uuid:$id})<-[r:SAVED_IN]-(s:Style)
+         WITH c, r, s ORDER BY r.position
+         WITH c, collect(s.uuid) AS ordered
+         WHERE $styleId IN ordered
+         WITH c, [x IN ordered WHERE x <> $styleId] AS rest
+         WITH c, rest[..$position] + [$styleId] + rest[$position..] AS ordered
+         UNWIND range(0, size(ordered) - 1) AS index
+         MATCH (c)<-[r:SAVED_IN]-(:Style {uuid:ordered[index]})
+         SET r.position=index
+         RETURN count(r) AS moved`,
+				map[string]interface{}{
+					"id":       id,
+					"styleId":  styleId,
+					"position": position,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			moved, _ := record.Get("moved")
+			if moved == int64(0) {
+				return errStyleNotInCollection, nil
+			}
+			return nil, nil
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "moved successfully", nil
+}
+
+// save adds a style to the default board of userName.
+func (c *CollectionStorage) save(userName string, styleId string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			id, err := defaultCollection(tx, userName, ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			err = addStyle(tx, userName, id, styleId, ctx)
+			if errors.Is(err, errStyleNotFound) {
+				return err, nil
+			}
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "saved successfully", nil
+}
+
+// unsave removes a style from every collection of userName.
+func (c *CollectionStorage) unsave(userName string, styleId string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (:User {userName:$userName})<-[:OWNED_BY]-(c:Collection)<-[r:SAVED_IN]-(s:Style {uuid:$styleId})
+         OPTIONAL MATCH (c)-[cover:COVER]->(s)
+         DELETE r, cover`,
+				map[string]interface{}{
+					"userName": userName,
+					"styleId":  styleId,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "removed successfully", nil
+}
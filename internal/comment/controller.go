@@ -0,0 +1,249 @@
+package comment
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CommentController struct {
+	storage *CommentStorage
+}
+
+func NewCommentController(storage *CommentStorage) *CommentController {
+	return &CommentController{
+		storage: storage,
+	}
+}
+
+var validate = validator.New()
+
+// commentErrorStatus maps the errors of the comment storage to the status
+// they are answered with.
+func commentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errStyleNotFound), errors.Is(err, errCommentNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, errNotCommentAuthor), errors.Is(err, errCannotDeleteComment):
+		return fiber.StatusForbidden
+	case errors.Is(err, errInvalidCursor):
+		return fiber.StatusBadRequest
+	default:
+		return 0
+	}
+}
+
+type createCommentRequest struct {
+	Text     string `json:"text" validate:"required,max=1000"`
+	ParentId string `json:"parentId"`
+}
+
+type createCommentData struct {
+	Id string `json:"id"`
+}
+
+type createCommentResponse struct {
+	Data    *createCommentData `json:"data"`
+	Message string             `json:"message"`
+	Success bool               `json:"success"`
+}
+
+func (cc *CommentController) createComment(c *fiber.Ctx) error {
+	styleId := c.Params("styleId")
+
+	var req createCommentRequest
+	c.BodyParser(&req)
+	req.Text = strings.TrimSpace(req.Text)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(createCommentResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	id, err := cc.storage.create(userName, styleId, req.ParentId, req.Text, c.Context())
+	if status := commentErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(createCommentResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(createCommentResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(createCommentResponse{
+		Data:    &createCommentData{Id: id},
+		Message: "created successfully",
+		Success: true,
+	})
+}
+
+type getCommentsResponse struct {
+	Data    []comment `json:"data"`
+	Message string    `json:"message"`
+	Success bool      `json:"success"`
+}
+
+func (cc *CommentController) getComments(c *fiber.Ctx) error {
+	styleId := c.Params("styleId")
+	cursor := c.Query("cursor")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	result, err := cc.storage.comments(userName, styleId, cursor, c.Context())
+	if status := commentErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(getCommentsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCommentsResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCommentsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+func (cc *CommentController) getReplies(c *fiber.Ctx) error {
+	id := c.Params("id")
+	cursor := c.Query("cursor")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	result, err := cc.storage.replies(userName, id, cursor, c.Context())
+	if status := commentErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(getCommentsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getCommentsResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getCommentsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type updateCommentRequest struct {
+	Text string `json:"text" validate:"required,max=1000"`
+}
+type updateCommentResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (cc *CommentController) updateComment(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req updateCommentRequest
+	c.BodyParser(&req)
+	req.Text = strings.TrimSpace(req.Text)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateCommentResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.update(userName, id, req.Text, c.Context())
+	if status := commentErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(updateCommentResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateCommentResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updateCommentResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type deleteCommentResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (cc *CommentController) deleteComment(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := cc.storage.delete(userName, id, c.Context())
+	if status := commentErrorStatus(err); status != 0 {
+		return c.Status(status).JSON(deleteCommentResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteCommentResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deleteCommentResponse{
+		Message: message,
+		Success: true,
+	})
+}
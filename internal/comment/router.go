@@ -0,0 +1,17 @@
+package comment
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/zone/IStyle/internal/middleware"
+)
+
+func AddCommentRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, controller *CommentController) {
+	auth := app.Group("/auth")
+
+	comment := auth.Group("/comment", middleware.VerifyUser)
+	comment.Get("/style/:styleId", controller.getComments)
+	comment.Post("/style/:styleId", controller.createComment)
+	comment.Get("/:id/replies", controller.getReplies)
+	comment.Patch("/:id", controller.updateComment)
+	comment.Delete("/:id", controller.deleteComment)
+}
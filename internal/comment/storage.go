@@ -0,0 +1,487 @@
+package comment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+type CommentStorage struct {
+	db     neo4j.DriverWithContext
+	dbName string
+}
+
+func NewCommentStorage(db neo4j.DriverWithContext, dbName string) *CommentStorage {
+	return &CommentStorage{
+		db:     db,
+		dbName: dbName,
+	}
+}
+
+const commentPageSize = 20
+
+var (
+	errStyleNotFound       = errors.New("style does not exist")
+	errCommentNotFound     = errors.New("comment does not exist")
+	errNotCommentAuthor    = errors.New("only the author can edit this comment")
+	errCannotDeleteComment = errors.New("only the author or the style owner can delete this comment")
+	errInvalidCursor       = errors.New("invalid cursor")
+)
+
+// parseCursor splits a cursor into the created_at and the id of the last
+// comment of the previous page. The id breaks ties between comments created
+// within the same second.
+func parseCursor(cursor string) (string, string, error) {
+	if cursor == "" {
+		return "", "", nil
+	}
+
+	createdAt, id, ok := strings.Cut(cursor, ",")
+	if !ok || id == "" {
+		return "", "", errInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339, createdAt); err != nil {
+		return "", "", errInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+// mentionPattern matches @userName, but not the domain of an email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.])@([A-Za-z0-9_.]+)`)
+
+// mentions returns the user names mentioned in text, each once.
+func mentions(text string) []string {
+	userNames := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// a mention at the end of a sentence keeps its full stop otherwise
+		userName := strings.TrimRight(match[1], ".")
+		if userName == "" {
+			continue
+		}
+
+		seen := false
+		for _, existing := range userNames {
+			if existing == userName {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			userNames = append(userNames, userName)
+		}
+	}
+	return userNames
+}
+
+type comment struct {
+	Id         string      `json:"id"`
+	Text       string      `json:"text"`
+	User       commentUser `json:"user"`
+	ParentId   string      `json:"parentId"`
+	ReplyCount int         `json:"replyCount"`
+	Mentions   []string    `json:"mentions"`
+	IsEdited   bool        `json:"isEdited"`
+	Created_at string      `json:"created_at"`
+	Updated_at string      `json:"updated_at"`
+	// Cursor is passed back to get the page after this comment
+	Cursor string `json:"cursor"`
+}
+
+type commentUser struct {
+	UserName   string `json:"userName"`
+	ProfilePic string `json:"profilePic"`
+}
+
+// styleVisible reports whether userName can see the style, which is what
+// reading and writing its comments requires.
+func styleVisible(tx neo4j.ManagedTransaction, userName string, styleId string, ctx context.Context) (bool, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (s:Style {uuid:$styleId})-[:CREATED_BY]->(p:User)
+     WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+     AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+     RETURN s.uuid AS id`,
+		map[string]interface{}{
+			"styleId":  styleId,
+			"userName": userName,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// linkMentions points the comment at the users mentioned in its text,
+// dropping the mentions of a previous version. Unknown user names and users
+// with a block between them and the author are skipped.
+func linkMentions(tx neo4j.ManagedTransaction, id string, text string, ctx context.Context) error {
+	_, err := tx.Run(ctx,
+		`MATCH (c:Comment {uuid:$id})-[:COMMENTED_BY]->(author:User)
+     OPTIONAL MATCH (c)-[old:MENTIONS]->(:User)
+     DELETE old
+     WITH DISTINCT c, author
+     UNWIND $userNames AS userName
+     MATCH (m:User {userName:userName})
+     WHERE NOT (author)-[:BLOCKED]-(m)
+     MERGE (c)-[:MENTIONS]->(m)`,
+		map[string]interface{}{
+			"id":        id,
+			"userNames": mentions(text),
+		},
+	)
+	return err
+}
+
+// create adds a comment on a style and returns its id. A reply to a reply
+// is attached to the top level comment, threads are one level deep.
+func (c *CommentStorage) create(userName string, styleId string, parentId string, text string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// not found errors are returned as the result, not as a failure
+			visible, err := styleVisible(tx, userName, styleId, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !visible {
+				return errStyleNotFound, nil
+			}
+
+			if parentId != "" {
+				result, err := tx.Run(ctx,
+					`MATCH (parent:Comment {uuid:$parentId})-[:COMMENT_ON]->(:Style {uuid:$styleId})
+           OPTIONAL MATCH (parent)-[:REPLY_TO]->(root:Comment)
+           RETURN coalesce(root.uuid, parent.uuid) AS id`,
+					map[string]interface{}{
+						"parentId": parentId,
+						"styleId":  styleId,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+				records, err := result.Collect(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if len(records) == 0 {
+					return errCommentNotFound, nil
+				}
+				root, _ := records[0].Get("id")
+				parentId = root.(string)
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MATCH (s:Style {uuid:$styleId})
+         CREATE (c:Comment {uuid:randomUUID(), text:$text, created_at:datetime($now), updated_at:datetime($now)})-[:COMMENTED_BY]->(u)
+         CREATE (c)-[:COMMENT_ON]->(s)
+         WITH c
+         OPTIONAL MATCH (parent:Comment {uuid:$parentId})
+         FOREACH (p IN CASE WHEN parent IS NULL THEN [] ELSE [parent] END | CREATE (c)-[:REPLY_TO]->(p))
+         RETURN c.uuid AS id`,
+				map[string]interface{}{
+					"userName": userName,
+					"styleId":  styleId,
+					"parentId": parentId,
+					"text":     text,
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			id, _ := record.Get("id")
+
+			if err := linkMentions(tx, id.(string), text, ctx); err != nil {
+				return nil, err
+			}
+			return id, nil
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return result.(string), nil
+}
+
+// commentOwners returns the author of a comment and the creator of the
+// style it is on. Both are empty when the comment does not exist.
+func commentOwners(tx neo4j.ManagedTransaction, id string, ctx context.Context) (string, string, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (c:Comment {uuid:$id})-[:COMMENTED_BY]->(a:User)
+     MATCH (c)-[:COMMENT_ON]->(:Style)-[:CREATED_BY]->(o:User)
+     RETURN a.userName AS author, o.userName AS styleOwner`,
+		map[string]interface{}{
+			"id": id,
+		},
+	)
+	if err != nil {
+		return "", "", err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if len(records) == 0 {
+		return "", "", nil
+	}
+
+	author, _ := records[0].Get("author")
+	styleOwner, _ := records[0].Get("styleOwner")
+	return author.(string), styleOwner.(string), nil
+}
+
+// update replaces the text of a comment and the users it mentions.
+func (c *CommentStorage) update(userName string, id string, text string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// ownership errors are returned as the result, not as a failure
+			author, _, err := commentOwners(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if author == "" {
+				return errCommentNotFound, nil
+			}
+			if author != userName {
+				return errNotCommentAuthor, nil
+			}
+
+			_, err = tx.Run(ctx,
+				"MATCH (c:Comment {uuid:$id}) SET c.text=$text, c.edited=true, c.updated_at=datetime($now)",
+				map[string]interface{}{
+					"id":   id,
+					"text": text,
+					"now":  time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, linkMentions(tx, id, text, ctx)
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "updated successfully", nil
+}
+
+// delete removes a comment together with its replies. Besides the author
+// the creator of the style can delete comments on it.
+func (c *CommentStorage) delete(userName string, id string, ctx context.Context) (string, error) {
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			author, styleOwner, err := commentOwners(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if author == "" {
+				return errCommentNotFound, nil
+			}
+			if author != userName && styleOwner != userName {
+				return errCannotDeleteComment, nil
+			}
+
+			_, err = tx.Run(ctx,
+				`MATCH (c:Comment {uuid:$id})
+         OPTIONAL MATCH (c)<-[:REPLY_TO]-(reply:Comment)
+         WITH c, collect(reply) AS replies
+         FOREACH (r IN replies | DETACH DELETE r)
+         DETACH DELETE c`,
+				map[string]interface{}{
+					"id": id,
+				},
+			)
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "deleted successfully", nil
+}
+
+// comments returns a page of the top level comments on a style, newest
+// first. cursor is the cursor of the last comment of the previous page.
+func (c *CommentStorage) comments(loggedInUser string, styleId string, cursor string, ctx context.Context) ([]comment, error) {
+	cursorAt, cursorId, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			visible, err := styleVisible(tx, loggedInUser, styleId, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !visible {
+				return errStyleNotFound, nil
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (c:Comment)-[:COMMENT_ON]->(:Style {uuid:$styleId})
+         WHERE NOT (c)-[:REPLY_TO]->(:Comment)
+         AND ($cursorAt = "" OR c.created_at < datetime($cursorAt) OR (c.created_at = datetime($cursorAt) AND c.uuid < $cursorId))
+         MATCH (c)-[:COMMENTED_BY]->(a:User)
+         WHERE NOT (:User {userName:$userName})-[:BLOCKED]-(a)
+         RETURN c.uuid AS id, c.text AS text, {userName:a.userName, profilePic:a.profilePic} AS user, "" AS parentId,
+         size([(reply:Comment)-[:REPLY_TO]->(c) | reply]) AS replyCount, [(c)-[:MENTIONS]->(m:User) | m.userName] AS mentions,
+         coalesce(c.edited, false) AS isEdited, toString(c.created_at) AS created_at, toString(c.updated_at) AS updated_at,
+         toString(c.created_at) + "," + c.uuid AS cursor
+         ORDER BY c.created_at DESC, c.uuid DESC
+         LIMIT $limit`,
+				map[string]interface{}{
+					"styleId":  styleId,
+					"userName": loggedInUser,
+					"cursorAt": cursorAt,
+					"cursorId": cursorId,
+					"limit":    commentPageSize,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+
+	var arr []comment
+	for _, record := range result.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(record.AsMap())
+
+		var structData comment
+		json.Unmarshal(jsonData, &structData)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
+
+// replies returns a page of the replies to a comment, oldest first. cursor
+// is the cursor of the last reply of the previous page.
+func (c *CommentStorage) replies(loggedInUser string, id string, cursor string, ctx context.Context) ([]comment, error) {
+	cursorAt, cursorId, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	session := c.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (:Comment {uuid:$id})-[:COMMENT_ON]->(s:Style) RETURN s.uuid AS styleId",
+				map[string]interface{}{
+					"id": id,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			records, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(records) == 0 {
+				return errCommentNotFound, nil
+			}
+			styleId, _ := records[0].Get("styleId")
+
+			visible, err := styleVisible(tx, loggedInUser, styleId.(string), ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !visible {
+				return errCommentNotFound, nil
+			}
+
+			result, err = tx.Run(ctx,
+				`MATCH (c:Comment)-[:REPLY_TO]->(parent:Comment {uuid:$id})
+         WHERE ($cursorAt = "" OR c.created_at > datetime($cursorAt) OR (c.created_at = datetime($cursorAt) AND c.uuid > $cursorId))
+         MATCH (c)-[:COMMENTED_BY]->(a:User)
+         WHERE NOT (:User {userName:$userName})-[:BLOCKED]-(a)
+         RETURN c.uuid AS id, c.text AS text, {userName:a.userName, profilePic:a.profilePic} AS user, parent.uuid AS parentId,
+         0 AS replyCount, [(c)-[:MENTIONS]->(m:User) | m.userName] AS mentions,
+         coalesce(c.edited, false) AS isEdited, toString(c.created_at) AS created_at, toString(c.updated_at) AS updated_at,
+         toString(c.created_at) + "," + c.uuid AS cursor
+         ORDER BY c.created_at, c.uuid
+         LIMIT $limit`,
+				map[string]interface{}{
+					"id":       id,
+					"userName": loggedInUser,
+					"cursorAt": cursorAt,
+					"cursorId": cursorId,
+					"limit":    commentPageSize,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+
+	var arr []comment
+	for _, record := range result.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(record.AsMap())
+
+		var structData comment
+		json.Unmarshal(jsonData, &structData)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
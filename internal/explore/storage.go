@@ -5,28 +5,36 @@ import (
 	"encoding/json"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
 )
 
 type ExploreStorage struct {
 	db     neo4j.DriverWithContext
 	dbName string
+	blobs  blobstore.BlobStore
 }
 
-func NewExploreStorage(db neo4j.DriverWithContext, dbName string) *ExploreStorage {
+func NewExploreStorage(db neo4j.DriverWithContext, dbName string, blobs blobstore.BlobStore) *ExploreStorage {
 	return &ExploreStorage{
 		db:     db,
 		dbName: dbName,
+		blobs:  blobs,
 	}
 }
 
 type exploreStyle struct {
-	Id         string `json:"id"`
-	Image      string `json:"image"`
-	Links      []link `json:"links"`
-	User       user   `json:"user"`
-	IsMarked   bool   `json:"isMarked"`
-	TrendCount int    `json:"trendCount"`
-	Created_at string `json:"created_at"`
+	Id           string         `json:"id"`
+	Image        string         `json:"image"`
+	Links        []link         `json:"links"`
+	User         user           `json:"user"`
+	IsMarked     bool           `json:"isMarked"`
+	IsSaved      bool           `json:"isSaved"`
+	TrendCount   int            `json:"trendCount"`
+	CommentCount int            `json:"commentCount"`
+	Created_at   string         `json:"created_at"`
+	MediaType    string         `json:"mediaType"`
+	Media        models.Gallery `json:"media"`
 }
 
 type link struct {
@@ -54,8 +62,11 @@ func (e *ExploreStorage) explore(userName string, ctx context.Context) ([]explor
         OPTIONAL MATCH (:User)-[r:MARKED_TREND]->(s)
         OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
         MATCH (s)-[:CREATED_BY]->(p:User)
+        WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+        AND NOT (:User {userName:$userName})-[:BLOCKED]-(p) AND NOT (:User {userName:$userName})-[:MUTED]->(p)
         WITH s,l,u,p, COUNT(r) AS trendCount
-        RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, trendCount,s.created_at AS created_at
+        RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, EXISTS((:User {userName:$userName})<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(s)) AS isSaved, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(s) | cm]) AS commentCount,s.created_at AS created_at,
+        coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media
 
         UNION
 
@@ -65,8 +76,11 @@ func (e *ExploreStorage) explore(userName string, ctx context.Context) ([]explor
         OPTIONAL MATCH (:User)-[r:MARKED_TREND]->(rs)
         OPTIONAL MATCH (rs)-[:LINKED_TO]->(l:Link)
         MATCH (rs)-[:CREATED_BY]->(p:User)
+        WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+        AND NOT (:User {userName:$userName})-[:BLOCKED]-(p) AND NOT (:User {userName:$userName})-[:MUTED]->(p)
         WITH rs,l,u,p, COUNT(r) AS trendCount
-        RETURN rs.uuid AS id, rs.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(rs)) AS isMarked, trendCount,rs.created_at AS created_at
+        RETURN rs.uuid AS id, rs.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(rs)) AS isMarked, EXISTS((:User {userName:$userName})<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(rs)) AS isSaved, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(rs) | cm]) AS commentCount,rs.created_at AS created_at,
+        coalesce(rs.media_type, 'image') AS mediaType, [(rs)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media
 
         UNION
 
@@ -76,8 +90,11 @@ func (e *ExploreStorage) explore(userName string, ctx context.Context) ([]explor
         OPTIONAL MATCH (:User)-[r:MARKED_TREND]->(hs)
         OPTIONAL MATCH (hs)-[:LINKED_TO]->(l:Link)
         MATCH (hs)-[:CREATED_BY]->(p:User)
+        WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+        AND NOT (:User {userName:$userName})-[:BLOCKED]-(p) AND NOT (:User {userName:$userName})-[:MUTED]->(p)
         WITH hs,l,u,p, COUNT(r) AS trendCount
-        RETURN hs.uuid AS id, hs.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(hs)) AS isMarked, trendCount,hs.created_at AS created_at
+        RETURN hs.uuid AS id, hs.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(hs)) AS isMarked, EXISTS((:User {userName:$userName})<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(hs)) AS isSaved, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(hs) | cm]) AS commentCount,hs.created_at AS created_at,
+        coalesce(hs.media_type, 'image') AS mediaType, [(hs)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media
       `,
 				map[string]interface{}{
 					"userName": userName,
@@ -105,15 +122,20 @@ func (e *ExploreStorage) explore(userName string, ctx context.Context) ([]explor
 
 		var structData exploreStyle
 		json.Unmarshal(jsonData, &structData)
+		structData.Media.Prepare(ctx, e.blobs)
 
 		arr = append(arr, exploreStyle{
-			Id:         structData.Id,
-			Image:      structData.Image,
-			Links:      structData.Links,
-			User:       structData.User,
-			IsMarked:   structData.IsMarked,
-			TrendCount: structData.TrendCount,
-			Created_at: structData.Created_at,
+			Id:           structData.Id,
+			Image:        structData.Image,
+			Links:        structData.Links,
+			User:         structData.User,
+			IsMarked:     structData.IsMarked,
+			IsSaved:      structData.IsSaved,
+			TrendCount:   structData.TrendCount,
+			CommentCount: structData.CommentCount,
+			Created_at:   structData.Created_at,
+			MediaType:    structData.MediaType,
+			Media:        structData.Media,
 		})
 	}
 
@@ -5,28 +5,36 @@ import (
 	"encoding/json"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
 )
 
 type FeedStorage struct {
 	db     neo4j.DriverWithContext
 	dbName string
+	blobs  blobstore.BlobStore
 }
 
-func NewFeedStorage(db neo4j.DriverWithContext, dbName string) *FeedStorage {
+func NewFeedStorage(db neo4j.DriverWithContext, dbName string, blobs blobstore.BlobStore) *FeedStorage {
 	return &FeedStorage{
 		db:     db,
 		dbName: dbName,
+		blobs:  blobs,
 	}
 }
 
 type feedStyle struct {
-	Id         string `json:"id"`
-	Image      string `json:"image"`
-	Links      []link `json:"links"`
-	User       user   `json:"user"`
-	IsMarked   bool   `json:"isMarked"`
-	TrendCount int    `json:"trendCount"`
-	Created_at string `json:"created_at"`
+	Id           string         `json:"id"`
+	Image        string         `json:"image"`
+	Links        []link         `json:"links"`
+	User         user           `json:"user"`
+	IsMarked     bool           `json:"isMarked"`
+	IsSaved      bool           `json:"isSaved"`
+	TrendCount   int            `json:"trendCount"`
+	CommentCount int            `json:"commentCount"`
+	Created_at   string         `json:"created_at"`
+	MediaType    string         `json:"mediaType"`
+	Media        models.Gallery `json:"media"`
 }
 
 type link struct {
@@ -53,12 +61,15 @@ func (f *FeedStorage) feed(userName string, cursor string, ctx context.Context)
       MATCH(u:User{userName:$userName})
       MATCH(p:User)
       MATCH(s:Style) 
-      WHERE ((s)-[:TAG_TO]->(:Tag)<-[:MARK_FAV]-(u) AND NOT (s)-[:CREATED_BY]->(u) AND (s)-[:CREATED_BY]->(p)) OR ((s)-[:CREATED_BY]->(p)<-[:FOLLOWING]-(u))
+      WHERE (((s)-[:TAG_TO]->(:Tag)<-[:MARK_FAV]-(u) AND NOT (s)-[:CREATED_BY]->(u) AND (s)-[:CREATED_BY]->(p)) OR ((s)-[:CREATED_BY]->(p)<-[:FOLLOWING]-(u)))
+      AND (NOT coalesce(p.isPrivate, false) OR (u)-[:FOLLOWING]->(p))
+      AND NOT (u)-[:BLOCKED]-(p) AND NOT (u)-[:MUTED]->(p)
       OPTIONAL MATCH (:User)-[r:MARKED_TREND]->(s)
       OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
       WITH s,l,p,u, COUNT(r) AS trendCount
       WHERE s.created_at<datetime($cursor)
-      RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, trendCount,s.created_at AS created_at ORDER BY s.created_at DESC
+      RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, EXISTS((:User {userName:$userName})<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(s)) AS isSaved, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(s) | cm]) AS commentCount,s.created_at AS created_at,
+      coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media ORDER BY s.created_at DESC
       LIMIT 4
       `,
 					map[string]interface{}{
@@ -84,11 +95,14 @@ func (f *FeedStorage) feed(userName string, cursor string, ctx context.Context)
       MATCH(u:User{userName:$userName})
       MATCH(p:User)
       MATCH(s:Style) 
-      WHERE ((s)-[:TAG_TO]->(:Tag)<-[:MARK_FAV]-(u) AND NOT (s)-[:CREATED_BY]->(u) AND (s)-[:CREATED_BY]->(p)) OR ((s)-[:CREATED_BY]->(p)<-[:FOLLOWING]-(u))
+      WHERE (((s)-[:TAG_TO]->(:Tag)<-[:MARK_FAV]-(u) AND NOT (s)-[:CREATED_BY]->(u) AND (s)-[:CREATED_BY]->(p)) OR ((s)-[:CREATED_BY]->(p)<-[:FOLLOWING]-(u)))
+      AND (NOT coalesce(p.isPrivate, false) OR (u)-[:FOLLOWING]->(p))
+      AND NOT (u)-[:BLOCKED]-(p) AND NOT (u)-[:MUTED]->(p)
       OPTIONAL MATCH (:User)-[r:MARKED_TREND]->(s)
       OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
       WITH s,l,p,u, COUNT(r) AS trendCount
-      RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, trendCount,s.created_at AS created_at ORDER BY s.created_at DESC
+      RETURN s.uuid AS id, s.image AS image, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic, isFollowing:EXISTS((u)-[:FOLLOWING]->(p))} AS user, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, EXISTS((:User {userName:$userName})<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(s)) AS isSaved, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(s) | cm]) AS commentCount,s.created_at AS created_at,
+      coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media ORDER BY s.created_at DESC
       LIMIT 4
       `,
 					map[string]interface{}{
@@ -120,15 +134,20 @@ func (f *FeedStorage) feed(userName string, cursor string, ctx context.Context)
 
 		var structData feedStyle
 		json.Unmarshal(jsonData, &structData)
+		structData.Media.Prepare(ctx, f.blobs)
 
 		arr = append(arr, feedStyle{
-			Id:         structData.Id,
-			Image:      structData.Image,
-			Links:      structData.Links,
-			User:       structData.User,
-			IsMarked:   structData.IsMarked,
-			TrendCount: structData.TrendCount,
-			Created_at: structData.Created_at,
+			Id:           structData.Id,
+			Image:        structData.Image,
+			Links:        structData.Links,
+			User:         structData.User,
+			IsMarked:     structData.IsMarked,
+			IsSaved:      structData.IsSaved,
+			TrendCount:   structData.TrendCount,
+			CommentCount: structData.CommentCount,
+			Created_at:   structData.Created_at,
+			MediaType:    structData.MediaType,
+			Media:        structData.Media,
 		})
 	}
 
@@ -1,42 +1,107 @@
 package middleware
 
 import (
+	"log"
+	"net/url"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/zone/IStyle/internal/security"
 	"github.com/zone/IStyle/pkg/jwtclaim"
 )
 
 type AuthMiddleware struct {
-	storage *MiddlewareStorage
+	storage  *MiddlewareStorage
+	security *security.SecurityStorage
 }
 
-func NewAuthMiddleware(storage *MiddlewareStorage) *AuthMiddleware {
+func NewAuthMiddleware(storage *MiddlewareStorage, security *security.SecurityStorage) *AuthMiddleware {
 	return &AuthMiddleware{
-		storage: storage,
+		storage:  storage,
+		security: security,
 	}
 }
 
-func (a *AuthMiddleware) VerifyOtpToken(c *fiber.Ctx) error {
-	reqToken := c.Request().Header.Peek("Authorization")
-
-	userName, valid := jwtclaim.ExtractVerifyUsername(string(reqToken))
+type stateErrorResponse struct {
+	Message  string `json:"message"`
+	State    string `json:"state"`
+	NextStep string `json:"nextStep"`
+	Success  bool   `json:"success"`
+}
 
-	if !valid {
+// VerifyOtpToken accepts any token of an active session, whatever step of
+// the sign up flow the user is at.
+func (a *AuthMiddleware) VerifyOtpToken(c *fiber.Ctx) error {
+	if !a.authenticate(c) {
 		return c.Status(fiber.StatusUnauthorized).SendString("unauthorized access")
 	}
-	c.Locals("userName", userName)
 	return c.Next()
 }
 
+// VerifyUser only lets fully onboarded users through.
 func (a *AuthMiddleware) VerifyUser(c *fiber.Ctx) error {
+	if !a.authenticate(c) {
+		return c.Status(fiber.StatusUnauthorized).SendString("unauthorized access")
+	}
+	return a.RequireState(jwtclaim.StateOnboarded)(c)
+}
+
+// RequireState rejects users that have not reached state yet and tells them
+// which step is missing. It must run after VerifyOtpToken.
+func (a *AuthMiddleware) RequireState(state jwtclaim.UserState) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		current, _ := c.Locals("userState").(jwtclaim.UserState)
+
+		if !current.AtLeast(state) {
+			if current == "" {
+				current = jwtclaim.StateRegistered
+			}
+			return c.Status(fiber.StatusForbidden).JSON(stateErrorResponse{
+				Message:  current.NextStep() + " required",
+				State:    string(current),
+				NextStep: current.NextStep(),
+				Success:  false,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireRole only lets users with at least role through. It must run after
+// VerifyOtpToken or VerifyUser.
+func (a *AuthMiddleware) RequireRole(role jwtclaim.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		current, _ := c.Locals("userRole").(jwtclaim.Role)
+
+		if !current.AtLeast(role) {
+			return c.Status(fiber.StatusForbidden).SendString("forbidden")
+		}
+
+		return c.Next()
+	}
+}
+
+func (a *AuthMiddleware) authenticate(c *fiber.Ctx) bool {
 	reqToken := c.Request().Header.Peek("Authorization")
 
-	userName, valid := jwtclaim.ExtractVerifyUsername(string(reqToken))
+	claims, err := jwtclaim.ParseToken(string(reqToken))
+	if err != nil || claims.SessionId == "" {
+		return false
+	}
 
-	if !valid {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthorized access")
+	// tokens of a revoked or expired session are rejected before they expire
+	userName := a.storage.sessionUserName(claims.UserName, claims.SessionId, c.Context())
+	if userName == "" {
+		return false
 	}
+
+	// the claim still has the old handle when the username changed since
 	c.Locals("userName", userName)
-	return c.Next()
+	c.Locals("sessionId", claims.SessionId)
+	c.Locals("userState", claims.State)
+	c.Locals("userRole", claims.Role)
+	return true
 }
 
 func (a *AuthMiddleware) CheckUserNameExists(c *fiber.Ctx) error {
@@ -45,8 +110,103 @@ func (a *AuthMiddleware) CheckUserNameExists(c *fiber.Ctx) error {
 	isValid := a.storage.userNameExists(userName, c.Context())
 
 	if !isValid {
+		// old handles redirect to the same route for the current one
+		if current := a.storage.renamedUserName(userName, c.Context()); current != "" {
+			return c.Redirect(renamedPath(c, userName, current), fiber.StatusPermanentRedirect)
+		}
 		return c.Status(fiber.StatusBadRequest).SendString("user does not exists")
 	}
 
 	return c.Next()
 }
+
+// renamedPath replaces the userName segment of the request path, keeping the
+// query string.
+func renamedPath(c *fiber.Ctx, userName string, current string) string {
+	segments := strings.Split(c.Path(), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] == userName {
+			segments[i] = url.PathEscape(current)
+			break
+		}
+	}
+
+	path := strings.Join(segments, "/")
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		path += "?" + string(query)
+	}
+	return path
+}
+
+// CanViewProfile only lets the owner and approved followers read the
+// content of a private account. It must run after VerifyOtpToken or
+// VerifyUser.
+func (a *AuthMiddleware) CanViewProfile(c *fiber.Ctx) error {
+	userName := c.Params("userName")
+	loggedInUser, _ := c.Locals("userName").(string)
+
+	if !a.storage.canViewProfile(userName, loggedInUser, c.Context()) {
+		return c.Status(fiber.StatusForbidden).SendString("this account is private")
+	}
+
+	return c.Next()
+}
+
+// CheckNotBlocked hides users that blocked the logged in user, or were
+// blocked by them, as if they did not exist. It must run after
+// VerifyOtpToken or VerifyUser.
+func (a *AuthMiddleware) CheckNotBlocked(c *fiber.Ctx) error {
+	userName := c.Params("userName")
+	loggedInUser, _ := c.Locals("userName").(string)
+
+	if a.storage.isBlocked(userName, loggedInUser, c.Context()) {
+		return c.Status(fiber.StatusBadRequest).SendString("user does not exists")
+	}
+
+	return c.Next()
+}
+
+// attemptRejectedLocal is set by handlers behind Throttle when the request
+// carried wrong credentials or a wrong code.
+const attemptRejectedLocal = "attemptRejected"
+
+// RejectAttempt marks the request as a failed attempt for Throttle.
+func RejectAttempt(c *fiber.Ctx) {
+	c.Locals(attemptRejectedLocal, true)
+}
+
+// Throttle counts failed requests per client ip and, once authenticated,
+// per account, and turns clients away while they are backing off. A request
+// failed when the handler called RejectAttempt, malformed requests are not
+// counted.
+func (a *AuthMiddleware) Throttle(c *fiber.Ctx) error {
+	keys := []security.Key{security.IPKey(c.IP())}
+	if userName, ok := c.Locals("userName").(string); ok {
+		keys = append(keys, security.AccountKey(userName))
+	}
+
+	retryAfter, err := a.security.Check(c.Context(), keys...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("something went wrong")
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, security.RetryAfter(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).SendString(security.ErrTooManyAttempts.Error())
+	}
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	if rejected, _ := c.Locals(attemptRejectedLocal).(bool); rejected {
+		if err := a.security.Fail(c.Context(), c.IP(), keys...); err != nil {
+			log.Printf("failed to record failed attempt: %v", err)
+		}
+	} else if c.Response().StatusCode() < fiber.StatusBadRequest && len(keys) > 1 {
+		if err := a.security.Succeed(c.Context(), keys[1]); err != nil {
+			log.Printf("failed to reset failed attempts: %v", err)
+		}
+	}
+
+	return nil
+}
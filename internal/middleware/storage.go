@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
@@ -43,3 +44,128 @@ func (m *MiddlewareStorage) userNameExists(userName string, ctx context.Context)
 
 	return result != nil
 }
+
+// sessionUserName returns the current userName of the user owning an active
+// session, or an empty string. Tokens issued before a username change carry
+// the old handle, so it is matched against the username history as well.
+func (m *MiddlewareStorage) sessionUserName(userName string, sessionId string, ctx context.Context) string {
+	session := m.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: m.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (s:Session {uuid:$sessionId})-[:SESSION_OF]->(u:User)
+         WHERE u.userName=$userName OR (u)-[:HAD_USERNAME]->(:UserNameHistory {userName:$userName})
+         RETURN u.userName AS userName, s.revoked_at IS NULL AND s.expires_at > datetime($now) AS isActive`,
+				map[string]interface{}{
+					"userName":  userName,
+					"sessionId": sessionId,
+					"now":       time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			isActive, _ := record.Get("isActive")
+			if isActive != true {
+				return nil, nil
+			}
+			userName, _ := record.Get("userName")
+			return userName, nil
+		})
+
+	current, _ := result.(string)
+	return current
+}
+
+// renamedUserName returns the current userName of the user that used to be
+// known as userName, or an empty string.
+func (m *MiddlewareStorage) renamedUserName(userName string, ctx context.Context) string {
+	session := m.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: m.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User)-[:HAD_USERNAME]->(:UserNameHistory {userName:$userName}) RETURN u.userName AS userName",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			userName, _ := record.Get("userName")
+			return userName, nil
+		})
+
+	current, _ := result.(string)
+	return current
+}
+
+func (m *MiddlewareStorage) canViewProfile(userName string, loggedInUser string, ctx context.Context) bool {
+	session := m.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: m.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MATCH (l:User {userName:$loggedInUser})
+         RETURN u = l OR NOT coalesce(u.isPrivate, false) OR EXISTS((l)-[:FOLLOWING]->(u)) AS canView`,
+				map[string]interface{}{
+					"userName":     userName,
+					"loggedInUser": loggedInUser,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			canView, _ := record.Get("canView")
+			return canView, nil
+		})
+
+	return result == true
+}
+
+func (m *MiddlewareStorage) isBlocked(userName string, loggedInUser string, ctx context.Context) bool {
+	session := m.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: m.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MATCH (l:User {userName:$loggedInUser})
+         RETURN EXISTS((l)-[:BLOCKED]-(u)) AS isBlocked`,
+				map[string]interface{}{
+					"userName":     userName,
+					"loggedInUser": loggedInUser,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			isBlocked, _ := record.Get("isBlocked")
+			return isBlocked, nil
+		})
+
+	return result == true
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zone/IStyle/pkg/blobstore"
+)
+
+// Media is the processed form of an uploaded image or video. Small, Medium
+// and Large hold blob keys until SignUrls turns them into download urls, for
+// a video they are the variants of its poster frame.
+type Media struct {
+	Image         string  `json:"image"`
+	Type          string  `json:"type"`
+	Position      int     `json:"position"`
+	Status        string  `json:"status"`
+	Video         string  `json:"video,omitempty"`
+	Poster        string  `json:"poster,omitempty"`
+	Duration      float64 `json:"duration,omitempty"`
+	Small         string  `json:"small,omitempty"`
+	Medium        string  `json:"medium,omitempty"`
+	Large         string  `json:"large,omitempty"`
+	Blurhash      string  `json:"blurhash,omitempty"`
+	DominantColor string  `json:"dominantColor,omitempty"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+}
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+)
+
+// SignUrls replaces the variant keys with presigned download urls. Variants
+// that can't be signed are left out.
+func (m *Media) SignUrls(ctx context.Context, blobs blobstore.BlobStore) {
+	if m == nil {
+		return
+	}
+
+	// videos are played from the original upload
+	if m.Type == MediaTypeVideo && m.Status == "ready" {
+		m.Video = m.Image
+	}
+
+	for _, variant := range []*string{&m.Video, &m.Poster, &m.Small, &m.Medium, &m.Large} {
+		if *variant == "" {
+			continue
+		}
+		url, err := blobs.PresignGet(ctx, *variant, blobstore.DownloadUrlTTL)
+		if err != nil {
+			url = ""
+		}
+		*variant = url
+	}
+}
+
+// Gallery is the list of images of a style, the first one is the cover.
+type Gallery []*Media
+
+// Prepare puts the images in their order and signs their variant urls.
+func (g Gallery) Prepare(ctx context.Context, blobs blobstore.BlobStore) {
+	sort.SliceStable(g, func(i, j int) bool {
+		return g[i].Position < g[j].Position
+	})
+
+	for _, media := range g {
+		media.SignUrls(ctx, blobs)
+	}
+}
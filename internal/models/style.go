@@ -1,9 +1,11 @@
 package models
 
 type Style struct {
-	ID         string `json:"id"`
-	Uuid       string `json:"uuid"`
-	Image      string `json:"image"`
-	Created_at string `json:"created_at"`
-	Updated_at string `json:"updated_at"`
+	ID         string  `json:"id"`
+	Uuid       string  `json:"uuid"`
+	Image      string  `json:"image"`
+	MediaType  string  `json:"mediaType"`
+	Media      Gallery `json:"media"`
+	Created_at string  `json:"created_at"`
+	Updated_at string  `json:"updated_at"`
 }
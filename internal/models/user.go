@@ -6,16 +6,18 @@ type User struct {
 	LastName         string `json:"lastName"`
 	UserName         string `json:"userName"`
 	ProfilePic       string `json:"profilePic"`
+	ProfileMedia     *Media `json:"profileMedia,omitempty"`
 	Mobile           string `json:"mobile"`
 	Email            string `json:"email"`
 	Password         string `json:"password"`
 	Created_at       string `json:"created_at"`
 	Updated_at       string `json:"updated_at"`
-	EmailOtp         string `json:"emailOtp"`
-	MobileOtp        string `json:"mobileOtp"`
 	IsEmailVerified  bool   `json:"isEmailVerified"`
 	IsMobileVerified bool   `json:"isMobileVerified"`
 	IsComplete       bool   `json:"isComplete"`
 	Bio              string `json:"bio"`
 	IsFollowing      bool   `json:"isFollowing"`
+	IsPrivate        bool   `json:"isPrivate"`
+	IsRequested      bool   `json:"isRequested"`
+	Role             string `json:"role"`
 }
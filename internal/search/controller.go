@@ -31,7 +31,9 @@ func (s *SearchController) getSearchByTextResult(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
-	result, err := s.storage.searchText(text, c.Context())
+	userName, _ := c.Locals("userName").(string)
+
+	result, err := s.storage.searchText(text, userName, c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(searchTextResponse{
 			Message: "something went wrong",
@@ -65,7 +67,9 @@ func (s *SearchController) searchStyleByTextResult(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
-	result, err := s.storage.stylesByText(text, c.Context())
+	userName, _ := c.Locals("userName").(string)
+
+	result, err := s.storage.stylesByText(text, userName, c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(styleByTextResponse{
 			Message: "something went wrong",
@@ -5,17 +5,21 @@ import (
 	"encoding/json"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
 )
 
 type SearchStorage struct {
 	db     neo4j.DriverWithContext
 	dbName string
+	blobs  blobstore.BlobStore
 }
 
-func NewSearchStorage(db neo4j.DriverWithContext, dbName string) *SearchStorage {
+func NewSearchStorage(db neo4j.DriverWithContext, dbName string, blobs blobstore.BlobStore) *SearchStorage {
 	return &SearchStorage{
 		db:     db,
 		dbName: dbName,
+		blobs:  blobs,
 	}
 }
 
@@ -26,7 +30,7 @@ type searchTextResult struct {
 	UserPic  string `json:"userPic"`
 }
 
-func (s *SearchStorage) searchText(text string, ctx context.Context) ([]searchTextResult, error) {
+func (s *SearchStorage) searchText(text string, userName string, ctx context.Context) ([]searchTextResult, error) {
 	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
@@ -34,9 +38,11 @@ func (s *SearchStorage) searchText(text string, ctx context.Context) ([]searchTe
 		func(tx neo4j.ManagedTransaction) (any, error) {
 			result, err := tx.Run(ctx,
 				`CALL db.index.fulltext.queryNodes("SearchWithTitleAndName", $text) YIELD node, score
+        WHERE NOT (:User {userName:$userName})-[:BLOCKED]-(node)
         RETURN node.userName AS userName, node.profilePic AS userPic, node.name AS tag, node.title AS hashtag,score ORDER BY score`,
 				map[string]any{
-					"text": text + "*",
+					"text":     text + "*",
+					"userName": userName,
 				},
 			)
 			if err != nil {
@@ -74,12 +80,15 @@ func (s *SearchStorage) searchText(text string, ctx context.Context) ([]searchTe
 }
 
 type stylesByTextResult struct {
-	Id         string `json:"id"`
-	Image      string `json:"image"`
-	Links      []link `json:"links"`
-	User       user   `json:"user"`
-	TrendCount int    `json:"trendCount"`
-	Created_at string `json:"created_at"`
+	Id           string         `json:"id"`
+	Image        string         `json:"image"`
+	Links        []link         `json:"links"`
+	User         user           `json:"user"`
+	TrendCount   int            `json:"trendCount"`
+	CommentCount int            `json:"commentCount"`
+	Created_at   string         `json:"created_at"`
+	MediaType    string         `json:"mediaType"`
+	Media        models.Gallery `json:"media"`
 }
 
 type link struct {
@@ -93,7 +102,7 @@ type user struct {
 	ProfilePic string `json:"profilePic"`
 }
 
-func (s *SearchStorage) stylesByText(text string, ctx context.Context) ([]stylesByTextResult, error) {
+func (s *SearchStorage) stylesByText(text string, userName string, ctx context.Context) ([]stylesByTextResult, error) {
 	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
@@ -103,13 +112,17 @@ func (s *SearchStorage) stylesByText(text string, ctx context.Context) ([]styles
 				`CALL db.index.fulltext.queryNodes("stylesByTagsAndHastags", $text) YIELD node, score
         MATCH (node)<-[r]-(s:Style)
         MATCH (s)-[:CREATED_BY]->(p:User)
+        WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+        AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
         OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
         OPTIONAL MATCH (:User)-[m:MARKED_TREND]->(s)
         WITH s,l,p, COUNT(m) AS trendCount
-        RETURN s.uuid as id, s.image as image, s.created_at as created_at, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic} as user, trendCount
+        RETURN s.uuid as id, s.image as image, s.created_at as created_at, collect(l{id:l.uuid,url:l.url,image:l.image}) AS links, {userName:p.userName, profilePic:p.profilePic} as user, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(s) | cm]) AS commentCount,
+        coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media
         `,
 				map[string]any{
-					"text": text + "*",
+					"text":     text + "*",
+					"userName": userName,
 				},
 			)
 			if err != nil {
@@ -134,14 +147,18 @@ func (s *SearchStorage) stylesByText(text string, ctx context.Context) ([]styles
 
 		var structData stylesByTextResult
 		json.Unmarshal(jsonData, &structData)
+		structData.Media.Prepare(ctx, s.blobs)
 
 		arr = append(arr, stylesByTextResult{
-			Id:         structData.Id,
-			Image:      structData.Image,
-			Links:      structData.Links,
-			User:       structData.User,
-			TrendCount: structData.TrendCount,
-			Created_at: structData.Created_at,
+			Id:           structData.Id,
+			Image:        structData.Image,
+			Links:        structData.Links,
+			User:         structData.User,
+			TrendCount:   structData.TrendCount,
+			CommentCount: structData.CommentCount,
+			Created_at:   structData.Created_at,
+			MediaType:    structData.MediaType,
+			Media:        structData.Media,
 		})
 	}
 
@@ -0,0 +1,351 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// policy decides how a throttled key backs off. The first FreeAttempts
+// failures are not delayed, every further failure doubles the delay and
+// LockoutAfter failures lock the key for lockoutDuration.
+type policy struct {
+	FreeAttempts int64
+	LockoutAfter int64
+}
+
+var policies = map[string]policy{
+	"account": {FreeAttempts: 3, LockoutAfter: 10},
+	"email":   {FreeAttempts: 3, LockoutAfter: 10},
+	"ip":      {FreeAttempts: 10, LockoutAfter: 100},
+}
+
+const (
+	backoffBase     = time.Second
+	maxBackoff      = 15 * time.Minute
+	lockoutDuration = 30 * time.Minute
+	// failureWindow is how long a key has to stay quiet before its counter
+	// starts again from zero.
+	failureWindow = time.Hour
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many failed attempts, try again later")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+)
+
+// RetryAfter formats wait for the Retry-After header.
+func RetryAfter(wait time.Duration) string {
+	return strconv.FormatInt(int64((wait+time.Second-1)/time.Second), 10)
+}
+
+// Key identifies what failed attempts are counted against.
+type Key struct {
+	kind  string
+	value string
+}
+
+// AccountKey counts failures against the user name of a signed in user.
+func AccountKey(userName string) Key {
+	return Key{kind: "account", value: userName}
+}
+
+// EmailKey counts failed logins against an email. It is kept apart from
+// AccountKey as a user name can look like someone else's email.
+func EmailKey(email string) Key {
+	return Key{kind: "email", value: strings.ToLower(email)}
+}
+
+func IPKey(ip string) Key {
+	return Key{kind: "ip", value: ip}
+}
+
+func (k Key) String() string {
+	return k.kind + ":" + k.value
+}
+
+type SecurityStorage struct {
+	db     neo4j.DriverWithContext
+	dbName string
+}
+
+func NewSecurityStorage(db neo4j.DriverWithContext, dbName string) *SecurityStorage {
+	return &SecurityStorage{
+		db:     db,
+		dbName: dbName,
+	}
+}
+
+// Check returns how long the caller has to wait before any of keys may be
+// tried again, zero if none of them is blocked.
+func (s *SecurityStorage) Check(ctx context.Context, keys ...Key) (time.Duration, error) {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (t:Throttle)
+         WHERE t.key IN $keys AND t.blocked_until > datetime($now)
+         RETURN max(t.blocked_until).epochSeconds AS blockedUntil`,
+				map[string]interface{}{
+					"keys": keyStrings(keys),
+					"now":  now.Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			blockedUntil, _ := record.Get("blockedUntil")
+			return blockedUntil, nil
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	blockedUntil, ok := result.(int64)
+	if !ok {
+		return 0, nil
+	}
+
+	return time.Unix(blockedUntil, 0).Sub(now), nil
+}
+
+// Fail counts a failed attempt against every key and blocks the keys that
+// ran out of free attempts. Lockouts are recorded as security events.
+func (s *SecurityStorage) Fail(ctx context.Context, ip string, keys ...Key) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	for _, key := range keys {
+		var lockedOut bool
+		var failures int64
+
+		_, err := session.ExecuteWrite(ctx,
+			func(tx neo4j.ManagedTransaction) (any, error) {
+				result, err := tx.Run(ctx,
+					`MERGE (t:Throttle {key:$key})
+           ON CREATE SET t.failures=0
+           SET t.failures=CASE WHEN t.last_failure_at < datetime($now) - duration({seconds:$window}) THEN 1 ELSE t.failures + 1 END,
+           t.last_failure_at=datetime($now)
+           RETURN t.failures AS failures`,
+					map[string]interface{}{
+						"key":    key.String(),
+						"now":    now.Format(time.RFC3339),
+						"window": int64(failureWindow.Seconds()),
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+				record, err := result.Single(ctx)
+				if err != nil {
+					return nil, err
+				}
+				value, _ := record.Get("failures")
+				failures, _ = value.(int64)
+
+				delay := backoff(policies[key.kind], failures)
+				if delay == 0 {
+					return nil, nil
+				}
+				lockedOut = failures == policies[key.kind].LockoutAfter
+
+				return tx.Run(ctx,
+					"MATCH (t:Throttle {key:$key}) SET t.blocked_until=datetime($now) + duration({seconds:$delay})",
+					map[string]interface{}{
+						"key":   key.String(),
+						"now":   now.Format(time.RFC3339),
+						"delay": int64(delay.Seconds()),
+					},
+				)
+			})
+		if err != nil {
+			return err
+		}
+
+		if lockedOut {
+			s.LogEvent(ctx, Event{
+				Type:    "lockout",
+				Subject: key.String(),
+				Ip:      ip,
+				Detail:  map[string]interface{}{"failures": failures, "lockedFor": lockoutDuration.String()},
+			})
+		}
+	}
+
+	return nil
+}
+
+// Succeed clears the failure counter of key after a successful attempt.
+func (s *SecurityStorage) Succeed(ctx context.Context, key Key) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (t:Throttle {key:$key}) DELETE t",
+				map[string]interface{}{
+					"key": key.String(),
+				},
+			)
+		})
+
+	return err
+}
+
+type Event struct {
+	Id         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Subject    string                 `json:"subject"`
+	Ip         string                 `json:"ip"`
+	Detail     map[string]interface{} `json:"detail"`
+	Created_at string                 `json:"created_at"`
+	// Cursor is passed back to get the page after this event
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// LogEvent appends event to the security event log. Failures to store the
+// event are only logged, they must never fail the request that caused it.
+func (s *SecurityStorage) LogEvent(ctx context.Context, event Event) {
+	log.Printf("security event %s subject=%s ip=%s detail=%v", event.Type, event.Subject, event.Ip, event.Detail)
+
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	detail, _ := json.Marshal(event.Detail)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"CREATE (:SecurityEvent {uuid:randomUUID(), type:$type, subject:$subject, ip:$ip, detail:$detail, created_at:datetime($now)})",
+				map[string]interface{}{
+					"type":    event.Type,
+					"subject": event.Subject,
+					"ip":      event.Ip,
+					"detail":  string(detail),
+					"now":     time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		log.Printf("failed to store security event: %v", err)
+	}
+}
+
+// Events returns the security event log newest first, 50 events per page
+// starting after the event cursor was taken from.
+func (s *SecurityStorage) Events(ctx context.Context, cursor string) ([]Event, error) {
+	cursorAt, cursorId, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	events, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (e:SecurityEvent)
+         WHERE $cursorAt = "" OR e.created_at < datetime($cursorAt) OR (e.created_at = datetime($cursorAt) AND e.uuid < $cursorId)
+         RETURN e.uuid AS id, e.type AS type, e.subject AS subject, e.ip AS ip, e.detail AS detail, toString(e.created_at) AS created_at,
+         toString(e.created_at) + "," + e.uuid AS cursor
+         ORDER BY e.created_at DESC, e.uuid DESC
+         LIMIT 50`,
+				map[string]interface{}{
+					"cursorAt": cursorAt,
+					"cursorId": cursorId,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []Event
+	for _, record := range events.([]*neo4j.Record) {
+		detail, _ := record.Get("detail")
+		detailString, _ := detail.(string)
+
+		values := record.AsMap()
+		delete(values, "detail")
+
+		jsonData, _ := json.Marshal(values)
+		var event Event
+		json.Unmarshal(jsonData, &event)
+		json.Unmarshal([]byte(detailString), &event.Detail)
+
+		arr = append(arr, event)
+	}
+
+	return arr, nil
+}
+
+// parseCursor splits a cursor into the created_at and the id of the last
+// event of the previous page. The id breaks ties between events logged
+// within the same second.
+func parseCursor(cursor string) (string, string, error) {
+	if cursor == "" {
+		return "", "", nil
+	}
+
+	createdAt, id, ok := strings.Cut(cursor, ",")
+	if !ok || id == "" {
+		return "", "", ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339, createdAt); err != nil {
+		return "", "", ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+func backoff(p policy, failures int64) time.Duration {
+	if failures >= p.LockoutAfter {
+		return lockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := backoffBase
+	for i := p.FreeAttempts + 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+func keyStrings(keys []Key) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = key.String()
+	}
+	return values
+}
@@ -1,6 +1,7 @@
 package style
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,16 +10,19 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/zone/IStyle/pkg/signedurl"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
 )
 
 type StyleController struct {
 	storage *StyleStorage
+	blobs   blobstore.BlobStore
 }
 
-func NewStyleController(storage *StyleStorage) *StyleController {
+func NewStyleController(storage *StyleStorage, blobs blobstore.BlobStore) *StyleController {
 	return &StyleController{
 		storage: storage,
+		blobs:   blobs,
 	}
 }
 
@@ -29,8 +33,9 @@ type GetStyleUploadUrl struct {
 	Key string `json:"key"`
 }
 type GetStyleUploadUrlData struct {
-	Style GetStyleUploadUrl   `json:"style"`
-	Links []GetStyleUploadUrl `json:"links"`
+	Style  GetStyleUploadUrl   `json:"style"`
+	Images []GetStyleUploadUrl `json:"images"`
+	Links  []GetStyleUploadUrl `json:"links"`
 }
 
 type getStyleUploadUrlResponse struct {
@@ -39,15 +44,18 @@ type getStyleUploadUrlResponse struct {
 	Success bool                   `json:"success"`
 }
 
+// getStyleUploadUrlRequest ImageCount defaults to a single image. A style
+// has at most maxStyleImages images and 10 links.
 type getStyleUploadUrlRequest struct {
-	LinkCount int `json:"linkCount"`
+	ImageCount int `json:"imageCount"`
+	LinkCount  int `json:"linkCount" validate:"min=0,max=10"`
 }
 
-func getLinks(ch chan<- GetStyleUploadUrl, wg *sync.WaitGroup) {
+func getLinks(blobs blobstore.BlobStore, ctx context.Context, ch chan<- GetStyleUploadUrl, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	id := uuid.New()
-	linkUrl, _ := signedurl.GetSignedUrl(id.String())
+	linkUrl, _ := blobs.PresignPut(ctx, id.String(), blobstore.UploadUrlTTL)
 
 	ch <- GetStyleUploadUrl{
 		Url: linkUrl,
@@ -67,23 +75,42 @@ func (t *StyleController) getStyleUploadUrl(c *fiber.Ctx) error {
 		})
 	}
 
-	id := uuid.New()
-	mainStyleUrl, err := signedurl.GetSignedUrl(id.String())
-	var links []GetStyleUploadUrl
-
-	if err != nil {
+	imageCount := req.ImageCount
+	if imageCount == 0 {
+		imageCount = 1
+	}
+	if imageCount < 0 || imageCount > maxStyleImages {
 		return c.Status(fiber.StatusBadRequest).JSON(getStyleUploadUrlResponse{
-			Message: "something went wrong",
+			Message: fmt.Sprintf("a style can have at most %d images", maxStyleImages),
 			Success: false,
 		})
 	}
 
+	// the first image is the cover and is also returned as style
+	var images []GetStyleUploadUrl
+	for i := 0; i < imageCount; i++ {
+		id := uuid.New()
+		imageUrl, err := t.blobs.PresignPut(c.Context(), id.String(), blobstore.UploadUrlTTL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(getStyleUploadUrlResponse{
+				Message: "something went wrong",
+				Success: false,
+			})
+		}
+
+		images = append(images, GetStyleUploadUrl{
+			Url: imageUrl,
+			Key: id.String(),
+		})
+	}
+	var links []GetStyleUploadUrl
+
 	ch := make(chan GetStyleUploadUrl)
 	var wg sync.WaitGroup
 
 	for i := 0; i < req.LinkCount; i++ {
 		wg.Add(1)
-		go getLinks(ch, &wg)
+		go getLinks(t.blobs, c.Context(), ch, &wg)
 	}
 
 	go func() {
@@ -95,12 +122,34 @@ func (t *StyleController) getStyleUploadUrl(c *fiber.Ctx) error {
 		links = append(links, link)
 	}
 
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	// only keys handed out here are accepted when the style is created
+	var keys []string
+	for _, image := range images {
+		keys = append(keys, image.Key)
+	}
+	for _, link := range links {
+		keys = append(keys, link.Key)
+	}
+
+	err = t.storage.recordUploads(userName, keys, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getStyleUploadUrlResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
 	result := GetStyleUploadUrlData{
-		Style: GetStyleUploadUrl{
-			Url: mainStyleUrl,
-			Key: id.String(),
-		},
-		Links: links,
+		Style:  images[0],
+		Images: images,
+		Links:  links,
 	}
 
 	jsonData, _ := json.Marshal(result)
@@ -114,14 +163,184 @@ func (t *StyleController) getStyleUploadUrl(c *fiber.Ctx) error {
 	})
 }
 
+type getVideoUploadUrlRequest struct {
+	ContentType string `json:"contentType" validate:"required"`
+	Size        int64  `json:"size" validate:"required,min=1"`
+}
+
+type VideoUploadPart struct {
+	PartNumber int    `json:"partNumber"`
+	Url        string `json:"url"`
+}
+type GetVideoUploadUrlData struct {
+	Key      string            `json:"key"`
+	UploadId string            `json:"uploadId"`
+	PartSize int64             `json:"partSize"`
+	Parts    []VideoUploadPart `json:"parts"`
+}
+
+type getVideoUploadUrlResponse struct {
+	Data    *GetVideoUploadUrlData `json:"data"`
+	Message string                 `json:"message"`
+	Success bool                   `json:"success"`
+}
+
+// getVideoUploadUrl starts a multipart upload for a video. The client puts
+// each part of PartSize bytes to its url and completes the upload with the
+// returned ETags.
+func (t *StyleController) getVideoUploadUrl(c *fiber.Ctx) error {
+	var req getVideoUploadUrlRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	if !allowedVideoTypes[req.ContentType] {
+		return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+			Message: "unsupported video type",
+			Success: false,
+		})
+	}
+	if req.Size > maxVideoSize {
+		return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+			Message: fmt.Sprintf("videos can be at most %d MB", maxVideoSize>>20),
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	key := uuid.New().String()
+	uploadId, err := t.blobs.CreateMultipart(c.Context(), key, req.ContentType)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	partCount := int((req.Size + videoPartSize - 1) / videoPartSize)
+	var parts []VideoUploadPart
+	for partNumber := 1; partNumber <= partCount; partNumber++ {
+		partUrl, err := t.blobs.PresignPart(c.Context(), key, uploadId, partNumber, videoPartUrlTTL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+				Message: "something went wrong",
+				Success: false,
+			})
+		}
+
+		parts = append(parts, VideoUploadPart{
+			PartNumber: partNumber,
+			Url:        partUrl,
+		})
+	}
+
+	err = t.storage.recordVideoUpload(userName, key, uploadId, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getVideoUploadUrlResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getVideoUploadUrlResponse{
+		Data: &GetVideoUploadUrlData{
+			Key:      key,
+			UploadId: uploadId,
+			PartSize: videoPartSize,
+			Parts:    parts,
+		},
+		Message: "url created successfully",
+		Success: true,
+	})
+}
+
+type uploadedPart struct {
+	PartNumber int    `json:"partNumber" validate:"min=1"`
+	ETag       string `json:"etag" validate:"required"`
+}
+
+type completeVideoUploadRequest struct {
+	Key      string         `json:"key" validate:"required"`
+	UploadId string         `json:"uploadId" validate:"required"`
+	Parts    []uploadedPart `json:"parts" validate:"required,min=1,dive"`
+}
+type completeVideoUploadResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (t *StyleController) completeVideoUpload(c *fiber.Ctx) error {
+	var req completeVideoUploadRequest
+	c.BodyParser(&req)
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(completeVideoUploadResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	var parts []blobstore.Part
+	for _, part := range req.Parts {
+		parts = append(parts, blobstore.Part{
+			Number: part.PartNumber,
+			ETag:   part.ETag,
+		})
+	}
+
+	err = t.storage.completeVideoUpload(userName, req.Key, req.UploadId, parts, c.Context())
+	if errors.Is(err, errInvalidUpload) {
+		return c.Status(fiber.StatusBadRequest).JSON(completeVideoUploadResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(completeVideoUploadResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(completeVideoUploadResponse{
+		Message: "upload completed",
+		Success: true,
+	})
+}
+
 type link struct {
 	Url   string `json:"url"`
 	Image string `json:"image"`
 }
 
+// createStyleRequest Images is the ordered gallery of the style, Image is
+// still accepted for styles with a single image. Video is the key of a
+// completed video upload and can't be combined with images.
 type createStyleRequest struct {
-	Image    string   `json:"image"`
-	Links    []link   `json:"links"`
+	Image    string   `json:"image" validate:"required_without_all=Images Video"`
+	Images   []string `json:"images" validate:"unique,dive,required"`
+	Video    string   `json:"video"`
+	Links    []link   `json:"links" validate:"max=10"`
 	Tags     []string `json:"tags"`
 	Hashtags []string `json:"hashtags"`
 }
@@ -149,11 +368,34 @@ func (s *StyleController) createStyle(c *fiber.Ctx) error {
 		return errors.New("not able to covert")
 	}
 
+	images := req.Images
+	if len(images) == 0 && req.Image != "" {
+		images = []string{req.Image}
+	}
+	if req.Video != "" && len(images) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(createStyleResponse{
+			Message: "a style has either images or a video",
+			Success: false,
+		})
+	}
+	if req.Video == "" && (len(images) == 0 || len(images) > maxStyleImages) {
+		return c.Status(fiber.StatusBadRequest).JSON(createStyleResponse{
+			Message: fmt.Sprintf("a style needs between 1 and %d images", maxStyleImages),
+			Success: false,
+		})
+	}
+
 	var links []map[string]interface{}
 	data, _ := json.Marshal(req.Links)
 	json.Unmarshal(data, &links)
 
-	message, err := s.storage.create(userName, req.Image, links, req.Tags, req.Hashtags, c.Context())
+	message, err := s.storage.create(userName, images, req.Video, links, req.Tags, req.Hashtags, c.Context())
+	if errors.Is(err, errInvalidUpload) {
+		return c.Status(fiber.StatusBadRequest).JSON(createStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(createStyleResponse{
 			Message: "something went wrong",
@@ -168,8 +410,10 @@ func (s *StyleController) createStyle(c *fiber.Ctx) error {
 }
 
 type style struct {
-	ID    string `json:"id"`
-	Image string `json:"image"`
+	ID        string         `json:"id"`
+	Image     string         `json:"image"`
+	MediaType string         `json:"mediaType"`
+	Media     models.Gallery `json:"media"`
 }
 
 type getAllStyleResponse struct {
@@ -260,6 +504,12 @@ func (s *StyleController) markTrend(c *fiber.Ctx) error {
 	message, err := s.storage.trend(userName, req.Id, c.Context())
 
 	fmt.Println(err)
+	if errors.Is(err, errStyleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(markTrendResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(markTrendResponse{
 			Message: "something went wrong",
@@ -383,12 +633,16 @@ func (s *StyleController) getStyleById(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(styleByIdResponse{
 		Data: &styleById{
-			Id:         style.Id,
-			Image:      style.Image,
-			Links:      style.Links,
-			TrendCount: style.TrendCount,
-			IsMarked:   style.IsMarked,
-			User:       style.User,
+			Id:           style.Id,
+			Image:        style.Image,
+			Links:        style.Links,
+			TrendCount:   style.TrendCount,
+			CommentCount: style.CommentCount,
+			IsMarked:     style.IsMarked,
+			IsSaved:      style.IsSaved,
+			User:         style.User,
+			MediaType:    style.MediaType,
+			Media:        style.Media,
 		},
 		Message: "found successfully",
 		Success: true,
@@ -411,7 +665,15 @@ func (s *StyleController) getALlLikedUsers(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := s.storage.likedUsers(id, c.Context())
+	userName, _ := c.Locals("userName").(string)
+
+	result, err := s.storage.likedUsers(userName, id, c.Context())
+	if errors.Is(err, errStyleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(getALlLikedUsersResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(getALlLikedUsersResponse{
 			Message: err.Error(),
@@ -429,3 +691,141 @@ func (s *StyleController) getALlLikedUsers(c *fiber.Ctx) error {
 		Success: true,
 	})
 }
+
+// updateStyleRequest fields that are left out are not changed, an empty
+// list clears the links, tags or hashtags. Image replaces the gallery with
+// a single image.
+type updateStyleRequest struct {
+	Image    *string  `json:"image"`
+	Images   []string `json:"images" validate:"omitempty,unique,dive,required"`
+	Links    []link   `json:"links" validate:"max=10"`
+	Tags     []string `json:"tags"`
+	Hashtags []string `json:"hashtags"`
+}
+type updateStyleResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (s *StyleController) updateStyle(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req updateStyleRequest
+	if err := c.BodyParser(&req); err != nil || id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(updateStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	images := req.Images
+	if images == nil && req.Image != nil {
+		images = []string{*req.Image}
+	}
+	if images != nil && (len(images) == 0 || len(images) > maxStyleImages || images[0] == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(updateStyleResponse{
+			Message: fmt.Sprintf("a style needs between 1 and %d images", maxStyleImages),
+			Success: false,
+		})
+	}
+
+	var links []map[string]interface{}
+	if req.Links != nil {
+		data, _ := json.Marshal(req.Links)
+		json.Unmarshal(data, &links)
+	}
+
+	message, err := s.storage.update(userName, id, images, links, req.Tags, req.Hashtags, c.Context())
+	if errors.Is(err, errStyleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(updateStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errNotStyleOwner) {
+		return c.Status(fiber.StatusForbidden).JSON(updateStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errInvalidUpload) {
+		return c.Status(fiber.StatusBadRequest).JSON(updateStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updateStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type deleteStyleResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (s *StyleController) deleteStyle(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteStyleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := s.storage.delete(userName, id, c.Context())
+	if errors.Is(err, errStyleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(deleteStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errNotStyleOwner) {
+		return c.Status(fiber.StatusForbidden).JSON(deleteStyleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteStyleResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deleteStyleResponse{
+		Message: message,
+		Success: true,
+	})
+}
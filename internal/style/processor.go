@@ -0,0 +1,239 @@
+package style
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/imaging"
+	"github.com/zone/IStyle/pkg/video"
+)
+
+const (
+	// mediaBatch is how many images are processed per run.
+	mediaBatch = 10
+	// videoBatch is how many videos are processed per run.
+	videoBatch = 2
+	// posterAt is the second the poster frame is taken from, shorter
+	// videos use their middle.
+	posterAt = 1.0
+)
+
+// errVideoRejected marks videos that break the limits, they are not retried.
+var errVideoRejected = errors.New("video rejected")
+
+// imageRejected tells the images that can never be processed apart from
+// failures worth retrying.
+func imageRejected(err error) bool {
+	return errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrTooLarge)
+}
+
+// StartImageProcessor periodically processes the images of new styles and
+// links. The original is replaced by a copy without EXIF data, and the
+// resized variants, blurhash and dominant color are stored with its Media
+// node. The returned function stops it.
+func StartImageProcessor(storage *StyleStorage, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				keys, err := storage.claimPendingMedia(models.MediaTypeImage, mediaBatch, ctx)
+				if err != nil {
+					log.Printf("claiming images failed: %v", err)
+					continue
+				}
+
+				for _, key := range keys {
+					result, err := processImage(storage, key, ctx)
+					if err == nil {
+						err = storage.completeMedia(key, result, ctx)
+					}
+					if imageRejected(err) {
+						log.Printf("image %s rejected: %v", key, err)
+						if err := storage.rejectMedia(key, err.Error(), ctx); err != nil {
+							log.Printf("rejecting image %s failed: %v", key, err)
+						}
+						continue
+					}
+					if err != nil {
+						log.Printf("processing image %s failed: %v", key, err)
+						if err := storage.failMedia(key, ctx); err != nil {
+							log.Printf("requeueing image %s failed: %v", key, err)
+						}
+					}
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// processImage uploads the variants first and only then overwrites the
+// original, so a failed run leaves the upload untouched.
+func processImage(storage *StyleStorage, key string, ctx context.Context) (*imaging.Result, error) {
+	object, err := storage.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	result, err := imaging.Process(object)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, variant := range imaging.Variants {
+		encoded := result.Variants[variant.Name]
+		err := storage.blobs.Put(ctx, imaging.VariantKey(key, variant), encoded.ContentType, encoded.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = storage.blobs.Put(ctx, key, result.Stripped.ContentType, result.Stripped.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// StartVideoProcessor periodically checks new videos against the size and
+// duration limits and extracts their poster frame, which gets the same
+// variants and placeholder as an image. ffmpeg and ffprobe have to be on the
+// PATH. The returned function stops it.
+func StartVideoProcessor(storage *StyleStorage, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				keys, err := storage.claimPendingMedia(models.MediaTypeVideo, videoBatch, ctx)
+				if err != nil {
+					log.Printf("claiming videos failed: %v", err)
+					continue
+				}
+
+				for _, key := range keys {
+					info, poster, err := processVideo(storage, key, ctx)
+					if err == nil {
+						err = storage.completeVideo(key, info, poster, ctx)
+					}
+					if errors.Is(err, errVideoRejected) {
+						log.Printf("video %s rejected: %v", key, err)
+						if err := storage.rejectMedia(key, err.Error(), ctx); err != nil {
+							log.Printf("rejecting video %s failed: %v", key, err)
+						}
+						continue
+					}
+					if err != nil {
+						log.Printf("processing video %s failed: %v", key, err)
+						if err := storage.failMedia(key, ctx); err != nil {
+							log.Printf("requeueing video %s failed: %v", key, err)
+						}
+					}
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// processVideo validates the video stored under key and uploads its poster
+// frame together with the poster variants.
+func processVideo(storage *StyleStorage, key string, ctx context.Context) (*video.Info, *imaging.Result, error) {
+	// give up before another run claims the video again
+	ctx, cancel := context.WithTimeout(ctx, mediaClaimTimeout)
+	defer cancel()
+
+	object, err := storage.blobs.Head(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if object.Size > maxVideoSize {
+		return nil, nil, fmt.Errorf("%w: larger than %d MB", errVideoRejected, maxVideoSize>>20)
+	}
+	if !allowedVideoTypes[object.ContentType] {
+		return nil, nil, fmt.Errorf("%w: unsupported type %s", errVideoRejected, object.ContentType)
+	}
+
+	body, err := storage.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer body.Close()
+
+	// ffmpeg needs to seek, so the video is copied to a temporary file
+	file, err := os.CreateTemp("", "video-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, io.LimitReader(body, maxVideoSize+1)); err != nil {
+		return nil, nil, err
+	}
+
+	info, err := video.Probe(ctx, file.Name())
+	if errors.Is(err, video.ErrNoVideoStream) {
+		return nil, nil, fmt.Errorf("%w: %v", errVideoRejected, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Duration > maxVideoDuration.Seconds() {
+		return nil, nil, fmt.Errorf("%w: longer than %v", errVideoRejected, maxVideoDuration)
+	}
+
+	frame, err := video.Poster(ctx, file.Name(), math.Min(posterAt, info.Duration/2))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	poster, err := imaging.Process(bytes.NewReader(frame))
+	if imageRejected(err) {
+		return nil, nil, fmt.Errorf("%w: poster frame: %v", errVideoRejected, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	posterKey := video.PosterKey(key)
+	for _, variant := range imaging.Variants {
+		encoded := poster.Variants[variant.Name]
+		err := storage.blobs.Put(ctx, imaging.VariantKey(posterKey, variant), encoded.ContentType, encoded.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = storage.blobs.Put(ctx, posterKey, poster.Stripped.ContentType, poster.Stripped.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return info, poster, nil
+}
@@ -10,14 +10,18 @@ func AddStyleRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, contr
 
 	style := auth.Group("/style", middleware.VerifyUser)
 	style.Post("/upload-url", controller.getStyleUploadUrl)
+	style.Post("/video-upload-url", controller.getVideoUploadUrl)
+	style.Post("/video-upload-complete", controller.completeVideoUpload)
 	style.Post("/create", controller.createStyle)
 	style.Get("/all", controller.getAllUserStyles)
 	style.Post("/mark-trend", controller.markTrend)
 	style.Post("/unmark-trend", controller.unMarkTrend)
 	style.Post("/style-clicked", controller.styleClicked)
 	style.Get("/:id", controller.getStyleById)
+	style.Patch("/:id", controller.updateStyle)
+	style.Delete("/:id", controller.deleteStyle)
 	style.Get("/liked/:id", controller.getALlLikedUsers)
 
-	styleByUserName := style.Group("/user/:userName", middleware.CheckUserNameExists)
+	styleByUserName := style.Group("/user/:userName", middleware.CheckUserNameExists, middleware.CheckNotBlocked, middleware.CanViewProfile)
 	styleByUserName.Get("/", controller.getAllStylesByUserName)
 }
@@ -4,42 +4,83 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/pkg/blobstore"
+	"github.com/zone/IStyle/pkg/imaging"
+	"github.com/zone/IStyle/pkg/video"
 )
 
 type StyleStorage struct {
 	db     neo4j.DriverWithContext
 	dbName string
+	blobs  blobstore.BlobStore
 }
 
-func NewStyleStorage(db neo4j.DriverWithContext, dbName string) *StyleStorage {
+func NewStyleStorage(db neo4j.DriverWithContext, dbName string, blobs blobstore.BlobStore) *StyleStorage {
 	return &StyleStorage{
 		db:     db,
 		dbName: dbName,
+		blobs:  blobs,
 	}
 }
 
-func (s *StyleStorage) create(userName string, image string, links []map[string]interface{}, tags []string, hashtags []string, ctx context.Context) (string, error) {
+// maxStyleImages is how many images a single style can show.
+const maxStyleImages = 8
+
+// create stores a new style made of either images or a video. The first of
+// images is its cover and is kept as the image of the style for clients
+// that only show one, a video style gets its poster frame once processed.
+func (s *StyleStorage) create(userName string, images []string, videoKey string, links []map[string]interface{}, tags []string, hashtags []string, ctx context.Context) (string, error) {
 	now := time.Now()
+
+	mediaType := models.MediaTypeImage
+	var videoKeys []string
+	if videoKey != "" {
+		mediaType = models.MediaTypeVideo
+		videoKeys = []string{videoKey}
+	}
+
+	imageKeys := newUploadKeys(append(append([]string{}, images...), linkImages(links)...), nil)
+	if err := s.verifyUploads(userName, imageKeys, allowedUploadTypes, maxUploadSize, ctx); err != nil {
+		return "", err
+	}
+	if err := s.verifyUploads(userName, videoKeys, allowedVideoTypes, maxVideoSize, ctx); err != nil {
+		return "", err
+	}
+	keys := append(imageKeys, videoKeys...)
+
 	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
 	_, err := session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
+			if err := claimUploads(tx, userName, keys, ctx); err != nil {
+				return nil, err
+			}
+
 			return tx.Run(ctx,
 				`
 	      MATCH (u:User {userName:$userName})
-        CREATE (s:Style {image:$image, uuid:randomUUID(), created_at:datetime($createdAt), updated_at:datetime($updatedAt)})
+        CREATE (s:Style {image:$images[0], media_type:$mediaType, uuid:randomUUID(), created_at:datetime($createdAt), updated_at:datetime($updatedAt)})
         CREATE (s)-[:CREATED_BY]->(u)
+        FOREACH (key IN $videos | CREATE (s)-[:HAS_MEDIA]->(:Media {key:key, type:'video', position:0, status:'pending', created_at:datetime($createdAt)}))
+        WITH s
+        CALL{
+          WITH s
+          UNWIND range(0, size($images) - 1) AS position
+          CREATE (s)-[:HAS_MEDIA]->(:Media {key:$images[position], position:position, status:'pending', created_at:datetime($createdAt)})
+        }
         WITH s
         CALL{
           WITH s
           UNWIND $links AS link
           CREATE (l:Link {image:link.image, url:link.url, uuid:randomUUID(), created_at:datetime($createdAt), updated_at:datetime($updatedAt)})
           MERGE (s)-[:LINKED_TO]->(l)
+          FOREACH (key IN CASE WHEN link.image IS NULL OR link.image = "" THEN [] ELSE [link.image] END | CREATE (l)-[:HAS_MEDIA]->(:Media {key:key, status:'pending', created_at:datetime($createdAt)}))
         }
         WITH s
         CALL{
@@ -55,7 +96,9 @@ func (s *StyleStorage) create(userName string, image string, links []map[string]
 				`,
 				map[string]interface{}{
 					"userName":  userName,
-					"image":     image,
+					"images":    images,
+					"videos":    videoKeys,
+					"mediaType": mediaType,
 					"links":     links,
 					"tags":      tags,
 					"hashtags":  hashtags,
@@ -81,7 +124,7 @@ func (s *StyleStorage) getALLStyles(userName string, cursor string, ctx context.
       MATCH(u:User{userName:$userName})
       MATCH(s:Style) 
       WHERE (s)-[:CREATED_BY]->(u) AND s.uuid>$cursor
-      RETURN s.uuid AS uuid, s.image As image
+      RETURN s.uuid AS uuid, s.image As image, coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:coalesce(m.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height, .duration, .poster}] AS media
       ORDER BY s.uuid
       LIMIT 30
       `,
@@ -111,36 +154,57 @@ func (s *StyleStorage) getALLStyles(userName string, cursor string, ctx context.
 
 		var structData models.Style
 		json.Unmarshal(jsonData, &structData)
+		structData.Media.Prepare(ctx, s.blobs)
 
 		arr = append(arr, models.Style{
-			ID:    structData.Uuid,
-			Image: structData.Image,
+			ID:        structData.Uuid,
+			Image:     structData.Image,
+			MediaType: structData.MediaType,
+			Media:     structData.Media,
 		})
 	}
 
 	return arr, nil
 }
 
+// trend marks a style the user can see as trending, private styles only
+// for followers and never across a block.
 func (s *StyleStorage) trend(userName string, id string, ctx context.Context) (string, error) {
 	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
-	_, err := session.ExecuteWrite(ctx,
+	result, err := session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
-			return tx.Run(ctx,
+			result, err := tx.Run(ctx,
 				`
-				MATCH (s:Style {uuid:$id})
 				MATCH (u:User {userName:$userName})
+				MATCH (s:Style {uuid:$id})-[:CREATED_BY]->(p:User)
+				WHERE (p = u OR NOT coalesce(p.isPrivate, false) OR (u)-[:FOLLOWING]->(p)) AND NOT (u)-[:BLOCKED]-(p)
 				CREATE (u)-[:MARKED_TREND]->(s)
+				RETURN s.uuid AS id
 				`,
 				map[string]interface{}{
 					"userName": userName,
 					"id":       id,
 				})
+			if err != nil {
+				return nil, err
+			}
+			records, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(records) == 0 {
+				return errStyleNotFound, nil
+			}
+			return nil, nil
 		})
 	if err != nil {
 		return "", err
 	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
 
 	return "trend successfully", nil
 }
@@ -194,12 +258,16 @@ func (s *StyleStorage) clicked(userName string, id string, ctx context.Context)
 }
 
 type styleById struct {
-	Id         string      `json:"id"`
-	Image      string      `json:"image"`
-	Links      []styleLink `json:"links"`
-	TrendCount int64       `json:"trendCount"`
-	IsMarked   bool        `json:"isMarked"`
-	User       styleUser   `json:"user"`
+	Id           string         `json:"id"`
+	Image        string         `json:"image"`
+	Links        []styleLink    `json:"links"`
+	TrendCount   int64          `json:"trendCount"`
+	CommentCount int64          `json:"commentCount"`
+	IsMarked     bool           `json:"isMarked"`
+	IsSaved      bool           `json:"isSaved"`
+	User         styleUser      `json:"user"`
+	MediaType    string         `json:"mediaType"`
+	Media        models.Gallery `json:"media"`
 }
 type styleLink struct {
 	Id    string `json:"id"`
@@ -229,9 +297,11 @@ func (s *StyleStorage) styleById(userName string, id string, ctx context.Context
          MATCH (s:Style{uuid: $id})
          OPTIONAL MATCH ((s)-[:LINKED_TO]->(l:Link))
          MATCH ((s)-[:CREATED_BY]->(p:User))
+         WHERE (p = u OR NOT coalesce(p.isPrivate, false) OR (u)-[:FOLLOWING]->(p)) AND NOT (u)-[:BLOCKED]-(p)
          OPTIONAL MATCH ((:User)-[m:MARKED_TREND]->(s))
          WITH s,l,u,p, COUNT(m) AS trendCount
-        RETURN s.uuid AS id, s.image AS image, collect({id:l.uuid, image:l.image, url:l.url}) AS links, trendCount, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, {userName:p.userName,profilePic:p.profilePic} AS user
+        RETURN s.uuid AS id, s.image AS image, collect({id:l.uuid, image:l.image, url:l.url}) AS links, trendCount, size([(cm:Comment)-[:COMMENT_ON]->(s) | cm]) AS commentCount, EXISTS((u)-[:MARKED_TREND]->(s)) AS isMarked, EXISTS((u)<-[:OWNED_BY]-(:Collection)<-[:SAVED_IN]-(s)) AS isSaved, {userName:p.userName,profilePic:p.profilePic} AS user,
+        coalesce(s.media_type, 'image') AS mediaType, [(s)-[:HAS_MEDIA]->(media:Media) | media{image:media.key, type:coalesce(media.type, 'image'), .position, .status, .small, .medium, .large, .blurhash, dominantColor:media.dominant_color, .width, .height, .duration, .poster}] AS media
         `,
 				map[string]interface{}{
 					"userName": userName,
@@ -250,8 +320,12 @@ func (s *StyleStorage) styleById(userName string, id string, ctx context.Context
 			image, _ := record.Get("image")
 			links, _ := record.Get("links")
 			trendCount, _ := record.Get("trendCount")
+			commentCount, _ := record.Get("commentCount")
 			isMarked, _ := record.Get("isMarked")
+			isSaved, _ := record.Get("isSaved")
 			user, _ := record.Get("user")
+			mediaType, _ := record.Get("mediaType")
+			media, _ := record.Get("media")
 
 			var arr []styleLink
 			var transFormedArr []styleLink
@@ -268,17 +342,27 @@ func (s *StyleStorage) styleById(userName string, id string, ctx context.Context
 			userjsonData, _ := json.Marshal(user)
 			json.Unmarshal(userjsonData, &postUser)
 
+			var styleMedia models.Gallery
+			mediajsonData, _ := json.Marshal(media)
+			json.Unmarshal(mediajsonData, &styleMedia)
+
 			if isMarked == nil {
 				isMarked = false
 			}
+			// a video style has no image until its poster is extracted
+			imageKey, _ := image.(string)
 
 			return &styleById{
-				Id:         id.(string),
-				Image:      image.(string),
-				Links:      transFormedArr,
-				TrendCount: trendCount.(int64),
-				IsMarked:   isMarked.(bool),
-				User:       postUser,
+				Id:           id.(string),
+				Image:        imageKey,
+				Links:        transFormedArr,
+				TrendCount:   trendCount.(int64),
+				CommentCount: commentCount.(int64),
+				IsMarked:     isMarked.(bool),
+				IsSaved:      isSaved == true,
+				User:         postUser,
+				MediaType:    mediaType.(string),
+				Media:        styleMedia,
 			}, nil
 		})
 
@@ -288,6 +372,8 @@ func (s *StyleStorage) styleById(userName string, id string, ctx context.Context
 		return nil, errors.New("something went wrong")
 	}
 
+	style.Media.Prepare(ctx, s.blobs)
+
 	return style, nil
 }
 
@@ -296,7 +382,7 @@ type likedUser struct {
 	ProfilePic string `json:"profilePic"`
 }
 
-func (s *StyleStorage) likedUsers(id string, ctx context.Context) ([]likedUser, error) {
+func (s *StyleStorage) likedUsers(userName string, id string, ctx context.Context) ([]likedUser, error) {
 	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
@@ -308,14 +394,26 @@ func (s *StyleStorage) likedUsers(id string, ctx context.Context) ([]likedUser,
 
 	users, err := session.ExecuteRead(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
+			visible, err := styleVisible(tx, userName, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !visible {
+				return errStyleNotFound, nil
+			}
+
 			result, err := tx.Run(ctx,
 				`
-      MATCH(s:Style{uuid:$id})
-        WHERE (s)<-[:MARKED_TREND]-(u:User)
-      RETURN u.userName AS userName, s.profilePic As profilePic 
+      MATCH(s:Style{uuid:$id})-[:CREATED_BY]->(o:User)
+      MATCH(l:User{userName:$userName})
+        WHERE NOT (l)-[:BLOCKED]-(o)
+      MATCH (s)<-[:MARKED_TREND]-(u:User)
+        WHERE NOT (l)-[:BLOCKED]-(u)
+      RETURN u.userName AS userName, u.profilePic As profilePic 
       `,
 				map[string]interface{}{
-					"id": id,
+					"userName": userName,
+					"id":       id,
 				},
 			)
 			if err != nil {
@@ -333,6 +431,9 @@ func (s *StyleStorage) likedUsers(id string, ctx context.Context) ([]likedUser,
 	if err != nil {
 		return nil, err
 	}
+	if err, ok := users.(error); ok {
+		return nil, err
+	}
 
 	var arr []likedUser
 	for _, user := range users.([]*neo4j.Record) {
@@ -375,3 +476,758 @@ func (s *StyleStorage) checkStyleExists(id string, ctx context.Context) bool {
 
 	return result != nil
 }
+
+var (
+	errStyleNotFound = errors.New("style does not exist")
+	errNotStyleOwner = errors.New("only the creator can change this style")
+)
+
+// styleVisible tells whether userName may see the style, which takes
+// following its creator when the account is private and no block between
+// them.
+func styleVisible(tx neo4j.ManagedTransaction, userName string, id string, ctx context.Context) (bool, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (s:Style {uuid:$id})-[:CREATED_BY]->(p:User)
+     WHERE (p.userName = $userName OR NOT coalesce(p.isPrivate, false) OR (:User {userName:$userName})-[:FOLLOWING]->(p))
+     AND NOT (:User {userName:$userName})-[:BLOCKED]-(p)
+     RETURN s.uuid AS id`,
+		map[string]interface{}{
+			"id":       id,
+			"userName": userName,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// styleOwner returns the userName of the creator of the style, or an empty
+// string when the style does not exist.
+func styleOwner(tx neo4j.ManagedTransaction, id string, ctx context.Context) (string, error) {
+	result, err := tx.Run(ctx,
+		"MATCH (s:Style {uuid:$id})-[:CREATED_BY]->(u:User) RETURN u.userName AS owner",
+		map[string]interface{}{
+			"id": id,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+	owner, _ := records[0].Get("owner")
+	userName, _ := owner.(string)
+	return userName, nil
+}
+
+// update changes the parts of a style that are not nil. Images, links and
+// hashtags are replaced as a whole, images that are no longer used are
+// queued for deletion from the bucket.
+func (s *StyleStorage) update(userName string, id string, images []string, links []map[string]interface{}, tags []string, hashtags []string, ctx context.Context) (string, error) {
+	// only images that are not on the style yet have to be fresh uploads
+	keys := newUploadKeys(append(append([]string{}, images...), linkImages(links)...), s.styleImages(id, ctx))
+	if err := s.verifyUploads(userName, keys, allowedUploadTypes, maxUploadSize, ctx); err != nil {
+		return "", err
+	}
+
+	// a key can move between the gallery and the links, so only keys that
+	// neither of them uses anymore are deleted. Links that are not replaced
+	// keep their images.
+	var keptLinkImages interface{}
+	if links != nil {
+		keptLinkImages = append([]string{}, linkImages(links)...)
+	}
+
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now().Format(time.RFC3339)
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// ownership errors are returned as the result, not as a failure
+			owner, err := styleOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errStyleNotFound, nil
+			}
+			if owner != userName {
+				return errNotStyleOwner, nil
+			}
+
+			if err := claimUploads(tx, userName, keys, ctx); err != nil {
+				return nil, err
+			}
+
+			if images != nil {
+				// images that stay keep their processed media and only move
+				_, err = tx.Run(ctx,
+					`MATCH (s:Style {uuid:$id})
+           OPTIONAL MATCH (s)-[:HAS_MEDIA]->(m:Media)
+           WITH s, collect(m) AS previous, $images + coalesce($linkImages, [(s)-[:LINKED_TO]->(l:Link) | l.image]) AS kept
+           FOREACH (key IN CASE WHEN s.image IS NULL OR s.image = "" OR s.image IN kept OR s.image IN [x IN previous | x.key] THEN [] ELSE [s.image] END | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+           FOREACH (m IN [x IN previous WHERE NOT x.key IN $images] | FOREACH (key IN CASE WHEN m.key IN kept THEN [] ELSE [m.key] END | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)})) DETACH DELETE m)
+           SET s.image=$images[0], s.media_type='image'
+           WITH s
+           UNWIND range(0, size($images) - 1) AS position
+           OPTIONAL MATCH (s)-[:HAS_MEDIA]->(existing:Media {key:$images[position]})
+           SET existing.position=position
+           FOREACH (key IN CASE WHEN existing IS NULL THEN [$images[position]] ELSE [] END | CREATE (s)-[:HAS_MEDIA]->(:Media {key:key, position:position, status:'pending', created_at:datetime($now)}))`,
+					map[string]interface{}{
+						"id":         id,
+						"images":     images,
+						"linkImages": keptLinkImages,
+						"now":        now,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if links != nil {
+				_, err = tx.Run(ctx,
+					`MATCH (s:Style {uuid:$id})
+           WITH s, $images + [s.image] + [(s)-[:HAS_MEDIA]->(gm:Media) | gm.key] AS kept
+           OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
+           OPTIONAL MATCH (l)-[:HAS_MEDIA]->(m:Media)
+           FOREACH (key IN CASE WHEN l.image IS NULL OR l.image = "" OR l.image IN kept THEN [] ELSE [l.image] END | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+           DETACH DELETE l, m
+           WITH DISTINCT s
+           UNWIND $links AS link
+           CREATE (l:Link {image:link.image, url:link.url, uuid:randomUUID(), created_at:datetime($now), updated_at:datetime($now)})
+           MERGE (s)-[:LINKED_TO]->(l)
+           FOREACH (key IN CASE WHEN link.image IS NULL OR link.image = "" THEN [] ELSE [link.image] END | CREATE (l)-[:HAS_MEDIA]->(:Media {key:key, status:'pending', created_at:datetime($now)}))`,
+					map[string]interface{}{
+						"id":     id,
+						"links":  links,
+						"images": linkImages(links),
+						"now":    now,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if tags != nil {
+				_, err = tx.Run(ctx,
+					`MATCH (s:Style {uuid:$id})
+           OPTIONAL MATCH (s)-[r:TAG_TO]->(:Tag)
+           DELETE r
+           WITH DISTINCT s
+           UNWIND $tags AS tagId
+           MATCH (t:Tag {uuid:tagId})
+           MERGE (s)-[:TAG_TO]->(t)`,
+					map[string]interface{}{
+						"id":   id,
+						"tags": tags,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if hashtags != nil {
+				_, err = tx.Run(ctx,
+					`MATCH (s:Style {uuid:$id})
+           OPTIONAL MATCH (s)-[r:HASHTAG_TO]->(h:Hashtag)
+           DELETE r
+           WITH s, collect(h) AS previous
+           FOREACH (h IN [x IN previous WHERE NOT (x)<-[:HASHTAG_TO]-(:Style)] | DETACH DELETE h)
+           WITH s
+           UNWIND $hashtags AS hashtag
+           CREATE (h:Hashtag {title:hashtag, uuid:randomUUID(), created_at:datetime($now), updated_at:datetime($now)})
+           MERGE (s)-[:HASHTAG_TO]->(h)`,
+					map[string]interface{}{
+						"id":       id,
+						"hashtags": hashtags,
+						"now":      now,
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			_, err = tx.Run(ctx,
+				"MATCH (s:Style {uuid:$id}) SET s.updated_at=datetime($now)",
+				map[string]interface{}{
+					"id":  id,
+					"now": now,
+				},
+			)
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "updated successfully", nil
+}
+
+// delete removes a style together with its comments, trends, clicks and tag edges.
+// Links and hashtags no other style points to are removed as well and their
+// images are queued for deletion from the bucket.
+func (s *StyleStorage) delete(userName string, id string, ctx context.Context) (string, error) {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// ownership errors are returned as the result, not as a failure
+			owner, err := styleOwner(tx, id, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if owner == "" {
+				return errStyleNotFound, nil
+			}
+			if owner != userName {
+				return errNotStyleOwner, nil
+			}
+
+			_, err = tx.Run(ctx,
+				`MATCH (s:Style {uuid:$id})
+         OPTIONAL MATCH (s)<-[:COMMENT_ON]-(cm:Comment)
+         WITH s, collect(cm) AS comments
+         FOREACH (cm IN comments | DETACH DELETE cm)
+         WITH s
+         OPTIONAL MATCH (s)-[:HAS_MEDIA]->(m:Media)
+         WITH s, collect(m) AS media
+         OPTIONAL MATCH (s)-[:LINKED_TO|HASHTAG_TO]->(n)
+         WITH s, media, collect(DISTINCT n) AS attached
+         WITH s, media, attached, reduce(keys = [], key IN [s.image] + [x IN media | x.key] | CASE WHEN key IS NULL OR key = "" OR key IN keys THEN keys ELSE keys + key END) AS keys
+         FOREACH (key IN keys | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+         FOREACH (m IN media | DETACH DELETE m)
+         DETACH DELETE s
+         WITH attached
+         UNWIND attached AS n
+         WITH n WHERE NOT (n)<-[:LINKED_TO|HASHTAG_TO]-(:Style)
+         OPTIONAL MATCH (n)-[:HAS_MEDIA]->(nm:Media)
+         FOREACH (key IN CASE WHEN n.image IS NULL OR n.image = "" THEN [] ELSE [n.image] END | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+         DETACH DELETE n, nm`,
+				map[string]interface{}{
+					"id":  id,
+					"now": time.Now().Format(time.RFC3339),
+				},
+			)
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return "deleted successfully", nil
+}
+
+const (
+	// uploadKeyTTL is how long an issued upload key can be used for a style
+	uploadKeyTTL  = 24 * time.Hour
+	maxUploadSize = 10 << 20
+)
+
+// allowedUploadTypes are the formats the image pipeline can decode
+var allowedUploadTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+const (
+	maxVideoSize     = 200 << 20
+	maxVideoDuration = 60 * time.Second
+	// videoPartSize is the size of the parts a video is uploaded in, S3
+	// needs at least 5 MB for all but the last one
+	videoPartSize = 10 << 20
+	// videoPartUrlTTL is longer than UploadUrlTTL as large videos take a
+	// while on mobile connections
+	videoPartUrlTTL = time.Hour
+)
+
+var allowedVideoTypes = map[string]bool{
+	"video/mp4":       true,
+	"video/quicktime": true,
+	"video/webm":      true,
+}
+
+// recordVideoUpload remembers a multipart upload started for userName. The
+// upload id is removed once the upload is completed.
+func (s *StyleStorage) recordVideoUpload(userName string, key string, uploadId string, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         CREATE (:Upload {key:$key, upload_id:$uploadId, created_at:datetime($now), expires_at:datetime($now) + duration({seconds:$ttl})})-[:UPLOADED_BY]->(u)`,
+				map[string]interface{}{
+					"userName": userName,
+					"key":      key,
+					"uploadId": uploadId,
+					"now":      time.Now().Format(time.RFC3339),
+					"ttl":      int64(uploadKeyTTL.Seconds()),
+				},
+			)
+		})
+
+	return err
+}
+
+// completeVideoUpload joins the uploaded parts of a video userName started.
+func (s *StyleStorage) completeVideoUpload(userName string, key string, uploadId string, parts []blobstore.Part, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	found, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (up:Upload {key:$key, upload_id:$uploadId})-[:UPLOADED_BY]->(:User {userName:$userName})
+         WHERE up.expires_at > datetime($now)
+         RETURN count(up) > 0 AS found`,
+				map[string]interface{}{
+					"userName": userName,
+					"key":      key,
+					"uploadId": uploadId,
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			found, _ := record.Get("found")
+			return found, nil
+		})
+	if err != nil {
+		return err
+	}
+	if found != true {
+		return fmt.Errorf("%w: unknown upload %s", errInvalidUpload, key)
+	}
+
+	err = s.blobs.CompleteMultipart(ctx, key, uploadId, parts)
+	if errors.Is(err, blobstore.ErrInvalidUploadId) || errors.Is(err, blobstore.ErrInvalidPart) {
+		return fmt.Errorf("%w: %v", errInvalidUpload, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (up:Upload {key:$key, upload_id:$uploadId}) REMOVE up.upload_id",
+				map[string]interface{}{
+					"key":      key,
+					"uploadId": uploadId,
+				},
+			)
+		})
+
+	return err
+}
+
+var errInvalidUpload = errors.New("invalid upload")
+
+// recordUploads remembers the keys handed out to userName so that only
+// they can be used when creating or updating a style.
+func (s *StyleStorage) recordUploads(userName string, keys []string, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         UNWIND $keys AS key
+         CREATE (:Upload {key:key, created_at:datetime($now), expires_at:datetime($now) + duration({seconds:$ttl})})-[:UPLOADED_BY]->(u)`,
+				map[string]interface{}{
+					"userName": userName,
+					"keys":     keys,
+					"now":      time.Now().Format(time.RFC3339),
+					"ttl":      int64(uploadKeyTTL.Seconds()),
+				},
+			)
+		})
+
+	return err
+}
+
+// verifyUploads checks that every key was issued to userName and has not
+// expired, and that a file of one of the allowed types and within maxSize
+// was uploaded under it.
+func (s *StyleStorage) verifyUploads(userName string, keys []string, allowedTypes map[string]bool, maxSize int64, ctx context.Context) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	uploads, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`UNWIND $keys AS key
+         OPTIONAL MATCH (up:Upload {key:key})
+         OPTIONAL MATCH (up)-[:UPLOADED_BY]->(u:User)
+         RETURN key, up IS NOT NULL AS isIssued, u.userName AS owner, coalesce(up.expires_at < datetime($now), false) AS isExpired`,
+				map[string]interface{}{
+					"keys": keys,
+					"now":  time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range uploads.([]*neo4j.Record) {
+		key, _ := record.Get("key")
+		isIssued, _ := record.Get("isIssued")
+		owner, _ := record.Get("owner")
+		isExpired, _ := record.Get("isExpired")
+
+		switch {
+		case isIssued != true:
+			return fmt.Errorf("%w: unknown key %v", errInvalidUpload, key)
+		case owner != userName:
+			return fmt.Errorf("%w: key %v belongs to another user", errInvalidUpload, key)
+		case isExpired == true:
+			return fmt.Errorf("%w: key %v expired", errInvalidUpload, key)
+		}
+	}
+
+	for _, key := range keys {
+		object, err := s.blobs.Head(ctx, key)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return fmt.Errorf("%w: nothing was uploaded for key %s", errInvalidUpload, key)
+		}
+		if err != nil {
+			return err
+		}
+
+		if object.Size > maxSize {
+			return fmt.Errorf("%w: key %s is larger than %d MB", errInvalidUpload, key, maxSize>>20)
+		}
+		if !allowedTypes[object.ContentType] {
+			return fmt.Errorf("%w: key %s is not a supported file type", errInvalidUpload, key)
+		}
+	}
+
+	return nil
+}
+
+// claimUploads removes the upload records of keys so they can't be used for
+// another style. The error rolls tx back when one of them was claimed since
+// it was verified.
+func claimUploads(tx neo4j.ManagedTransaction, userName string, keys []string, ctx context.Context) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	result, err := tx.Run(ctx,
+		`MATCH (up:Upload)-[:UPLOADED_BY]->(:User {userName:$userName})
+     WHERE up.key IN $keys AND up.expires_at > datetime($now)
+     DETACH DELETE up
+     RETURN count(up) AS claimed`,
+		map[string]interface{}{
+			"userName": userName,
+			"keys":     keys,
+			"now":      time.Now().Format(time.RFC3339),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+
+	claimed, _ := record.Get("claimed")
+	if claimed != int64(len(keys)) {
+		return fmt.Errorf("%w: upload was already used", errInvalidUpload)
+	}
+	return nil
+}
+
+// styleImages returns the keys of the images a style currently uses.
+func (s *StyleStorage) styleImages(id string, ctx context.Context) []string {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (s:Style {uuid:$id})
+         OPTIONAL MATCH (s)-[:LINKED_TO]->(l:Link)
+         RETURN [s.image] + [(s)-[:HAS_MEDIA]->(m:Media) | m.key] + collect(l.image) AS keys`,
+				map[string]interface{}{
+					"id": id,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			keys, _ := record.Get("keys")
+			return keys, nil
+		})
+
+	var keys []string
+	list, _ := result.([]interface{})
+	for _, key := range list {
+		if k, ok := key.(string); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func linkImages(links []map[string]interface{}) []string {
+	var images []string
+	for _, link := range links {
+		if image, ok := link["image"].(string); ok {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// newUploadKeys returns the distinct, non empty keys that are not in
+// existing.
+func newUploadKeys(keys []string, existing []string) []string {
+	seen := make(map[string]bool)
+	for _, key := range existing {
+		seen[key] = true
+	}
+
+	var fresh []string
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		fresh = append(fresh, key)
+	}
+	return fresh
+}
+
+// mediaMaxAttempts is how often processing an image is tried before it is
+// marked as failed.
+const mediaMaxAttempts = 3
+
+// mediaClaimTimeout is how long a claimed image may take before another run
+// picks it up again.
+const mediaClaimTimeout = 10 * time.Minute
+
+// claimPendingMedia marks up to limit pending media of mediaType as
+// processing and returns their keys. Images uploaded before the pipeline
+// existed are queued here as well.
+func (s *StyleStorage) claimPendingMedia(mediaType string, limit int, ctx context.Context) ([]string, error) {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now().Format(time.RFC3339)
+	keys, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			if mediaType == models.MediaTypeImage {
+				if err := backfillMedia(tx, limit, now, ctx); err != nil {
+					return nil, err
+				}
+			}
+
+			result, err := tx.Run(ctx,
+				`MATCH (m:Media)
+         WHERE coalesce(m.type, 'image') = $type
+         AND (m.status = 'pending' OR (m.status = 'processing' AND m.claimed_at < datetime($now) - duration({seconds:$timeout})))
+         WITH m ORDER BY m.created_at LIMIT $limit
+         SET m.status='processing', m.claimed_at=datetime($now), m.attempts=coalesce(m.attempts, 0) + 1
+         RETURN m.key AS key`,
+				map[string]interface{}{
+					"type":    mediaType,
+					"limit":   limit,
+					"now":     now,
+					"timeout": int64(mediaClaimTimeout.Seconds()),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			records, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			var keys []string
+			for _, record := range records {
+				key, _ := record.Get("key")
+				if k, ok := key.(string); ok {
+					keys = append(keys, k)
+				}
+			}
+			return keys, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.([]string), nil
+}
+
+// backfillMedia queues the images of styles and links created before the
+// pipeline existed.
+func backfillMedia(tx neo4j.ManagedTransaction, limit int, now string, ctx context.Context) error {
+	_, err := tx.Run(ctx,
+		`MATCH (n)
+     WHERE (n:Style OR n:Link) AND n.image IS NOT NULL AND n.image <> "" AND NOT (n)-[:HAS_MEDIA]->(:Media)
+     WITH n LIMIT $limit
+     CREATE (n)-[:HAS_MEDIA]->(:Media {key:n.image, position:CASE WHEN n:Style THEN 0 END, status:'pending', created_at:datetime($now)})`,
+		map[string]interface{}{
+			"limit": limit,
+			"now":   now,
+		},
+	)
+	return err
+}
+
+func (s *StyleStorage) completeMedia(key string, result *imaging.Result, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	params := map[string]interface{}{
+		"key":           key,
+		"blurhash":      result.Blurhash,
+		"dominantColor": result.DominantColor,
+		"width":         result.Width,
+		"height":        result.Height,
+		"now":           time.Now().Format(time.RFC3339),
+	}
+	for _, variant := range imaging.Variants {
+		params[variant.Name] = imaging.VariantKey(key, variant)
+	}
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (m:Media {key:$key})
+         SET m.status='ready', m.small=$small, m.medium=$medium, m.large=$large, m.blurhash=$blurhash, m.dominant_color=$dominantColor,
+         m.width=$width, m.height=$height, m.processed_at=datetime($now)
+         REMOVE m.claimed_at`,
+				params,
+			)
+		})
+
+	return err
+}
+
+// failMedia puts an image back in the queue, or gives up on it once it
+// failed mediaMaxAttempts times.
+func (s *StyleStorage) failMedia(key string, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (m:Media {key:$key})
+         SET m.status=CASE WHEN m.attempts >= $maxAttempts THEN 'failed' ELSE 'pending' END
+         REMOVE m.claimed_at`,
+				map[string]interface{}{
+					"key":         key,
+					"maxAttempts": mediaMaxAttempts,
+				},
+			)
+		})
+
+	return err
+}
+
+// completeVideo stores the details of a processed video. The poster frame
+// becomes the image of its style for clients that only show images.
+func (s *StyleStorage) completeVideo(key string, info *video.Info, poster *imaging.Result, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	posterKey := video.PosterKey(key)
+	params := map[string]interface{}{
+		"key":           key,
+		"poster":        posterKey,
+		"blurhash":      poster.Blurhash,
+		"dominantColor": poster.DominantColor,
+		"width":         info.Width,
+		"height":        info.Height,
+		"duration":      info.Duration,
+		"now":           time.Now().Format(time.RFC3339),
+	}
+	for _, variant := range imaging.Variants {
+		params[variant.Name] = imaging.VariantKey(posterKey, variant)
+	}
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (m:Media {key:$key})
+         SET m.status='ready', m.poster=$poster, m.small=$small, m.medium=$medium, m.large=$large, m.blurhash=$blurhash, m.dominant_color=$dominantColor,
+         m.width=$width, m.height=$height, m.duration=$duration, m.processed_at=datetime($now)
+         REMOVE m.claimed_at
+         WITH m
+         MATCH (s:Style)-[:HAS_MEDIA]->(m)
+         SET s.image=$poster`,
+				params,
+			)
+		})
+
+	return err
+}
+
+// rejectMedia marks media that can never be processed as failed right
+// away, reason tells the creator why.
+func (s *StyleStorage) rejectMedia(key string, reason string, ctx context.Context) error {
+	session := s.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: s.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (m:Media {key:$key})
+         SET m.status='failed', m.error=$reason
+         REMOVE m.claimed_at`,
+				map[string]interface{}{
+					"key":    key,
+					"reason": reason,
+				},
+			)
+		})
+
+	return err
+}
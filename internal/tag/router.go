@@ -3,6 +3,7 @@ package tag
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/zone/IStyle/internal/middleware"
+	"github.com/zone/IStyle/pkg/jwtclaim"
 )
 
 func AddTagRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, controller *TagController) {
@@ -10,7 +11,7 @@ func AddTagRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, control
 
 	// add routes here
 
-	tag.Post("/create", controller.createTag)
+	tag.Post("/create", middleware.VerifyUser, middleware.RequireRole(jwtclaim.RoleAdmin), controller.createTag)
 	tag.Get("/all", controller.getAllTags)
 
 }
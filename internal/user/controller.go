@@ -1,23 +1,38 @@
 package user
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"log"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/zone/IStyle/pkg/otp"
-	"github.com/zone/IStyle/pkg/signedurl"
+	"github.com/zone/IStyle/internal/middleware"
+	"github.com/zone/IStyle/internal/models"
+	"github.com/zone/IStyle/internal/security"
+	"github.com/zone/IStyle/pkg/blobstore"
+	"github.com/zone/IStyle/pkg/jwtclaim"
+	"github.com/zone/IStyle/pkg/oidc"
+	"github.com/zone/IStyle/pkg/password"
 )
 
 type UserController struct {
-	storage *UserStorage
+	storage  *UserStorage
+	verifier *oidc.Verifier
+	security *security.SecurityStorage
+	blobs    blobstore.BlobStore
 }
 
-func NewUserController(storage *UserStorage) *UserController {
+func NewUserController(storage *UserStorage, verifier *oidc.Verifier, security *security.SecurityStorage, blobs blobstore.BlobStore) *UserController {
 	return &UserController{
-		storage: storage,
+		storage:  storage,
+		verifier: verifier,
+		security: security,
+		blobs:    blobs,
 	}
 }
 
@@ -32,9 +47,11 @@ type signUpRequest struct {
 }
 
 type signUpResponse struct {
-	Token   string `json:"token"`
-	Message string `json:"message"`
-	Success bool   `json:"success"`
+	Token        string               `json:"token"`
+	RefreshToken string               `json:"refreshToken"`
+	Reasons      []password.Violation `json:"reasons,omitempty"`
+	Message      string               `json:"message"`
+	Success      bool                 `json:"success"`
 }
 
 func (u *UserController) register(c *fiber.Ctx) error {
@@ -56,7 +73,16 @@ func (u *UserController) register(c *fiber.Ctx) error {
 		})
 	}
 
-	token, err := u.storage.signUp(req.FirstName, req.LastName, req.UserName, req.Email, req.Password, c.Context())
+	tokens, err := u.storage.signUp(req.FirstName, req.LastName, req.UserName, req.Email, req.Password, c.Context())
+
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(signUpResponse{
+			Reasons: policyErr.Violations,
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(signUpResponse{
 			Message: err.Error(),
@@ -65,9 +91,10 @@ func (u *UserController) register(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(signUpResponse{
-		Token:   token,
-		Success: true,
-		Message: "Otp sent successfully",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Success:      true,
+		Message:      "Otp sent successfully",
 	})
 }
 
@@ -104,10 +131,14 @@ func (u *UserController) verifyEmail(c *fiber.Ctx) error {
 	if !cnvErr {
 		return errors.New("not able to covert")
 	}
+	sessionId, _ := c.Locals("sessionId").(string)
 
-	token, err := u.storage.verifyEmail(req.Otp, userName, c.Context())
+	token, err := u.storage.verifyEmail(req.Otp, userName, sessionId, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(verifyResponse{
+		return c.Status(otpErrorStatus(err)).JSON(verifyResponse{
 			Message: err.Error(),
 			Success: false,
 		})
@@ -144,10 +175,14 @@ func (u *UserController) verifyMobile(c *fiber.Ctx) error {
 	if !cnvErr {
 		return errors.New("not able to covert")
 	}
+	sessionId, _ := c.Locals("sessionId").(string)
 
-	token, err := u.storage.verifyMobile(req.Otp, userName, c.Context())
+	token, err := u.storage.verifyMobile(req.Otp, userName, sessionId, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(verifyResponse{
+		return c.Status(otpErrorStatus(err)).JSON(verifyResponse{
 			Message: err.Error(),
 			Success: false,
 		})
@@ -160,14 +195,84 @@ func (u *UserController) verifyMobile(c *fiber.Ctx) error {
 	})
 }
 
+type resendOtpResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) resendEmailOtp(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := u.storage.resendEmailOtp(userName, c.Context())
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(resendOtpResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resendOtpResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) resendMobileOtp(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return errors.New("not able to covert")
+	}
+
+	message, err := u.storage.resendMobileOtp(userName, c.Context())
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(resendOtpResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resendOtpResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+// isRejectedAttempt reports whether err means the submitted credentials or
+// code were wrong. Only those requests count towards throttling.
+func isRejectedAttempt(err error) bool {
+	return errors.Is(err, errOtpInvalid) || errors.Is(err, errInvalidCredentials) || errors.Is(err, errIncorrectPassword) || errors.Is(err, errSessionInvalid)
+}
+
+func otpErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errOtpCooldown), errors.Is(err, errOtpLocked):
+		return fiber.StatusTooManyRequests
+	case errors.Is(err, errOtpInvalid), errors.Is(err, errOtpExpired):
+		return fiber.StatusBadRequest
+	case errors.Is(err, errTotpEnabled), errors.Is(err, errTotpNotEnabled):
+		return fiber.StatusConflict
+	}
+	return fiber.StatusInternalServerError
+}
+
 type loginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 type loginResponse struct {
-	Token   string `json:"token"`
-	Message string `json:"message"`
-	Success bool   `json:"success"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	MfaRequired  bool   `json:"mfaRequired"`
+	MfaToken     string `json:"mfaToken,omitempty"`
+	Message      string `json:"message"`
+	Success      bool   `json:"success"`
 }
 
 func (u *UserController) loginUser(c *fiber.Ctx) error {
@@ -188,17 +293,57 @@ func (u *UserController) loginUser(c *fiber.Ctx) error {
 		})
 	}
 
-	token, err := u.storage.login(req.Email, req.Password, c.Context())
+	// failures are counted per account and per client ip, whether or not
+	// the email is registered
+	keys := []security.Key{security.EmailKey(req.Email), security.IPKey(c.IP())}
+
+	retryAfter, err := u.security.Check(c.Context(), keys...)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(loginResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, security.RetryAfter(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).JSON(loginResponse{
+			Message: security.ErrTooManyAttempts.Error(),
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.login(req.Email, req.Password, c.Context())
+	if errors.Is(err, errInvalidCredentials) {
+		if err := u.security.Fail(c.Context(), c.IP(), keys...); err != nil {
+			log.Printf("failed to record failed login: %v", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(loginResponse{
 			Message: err.Error(),
 			Success: false,
 		})
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(loginResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+	if err := u.security.Succeed(c.Context(), keys[0]); err != nil {
+		log.Printf("failed to reset login failures: %v", err)
+	}
+	if tokens.MfaToken != "" {
+		return c.Status(fiber.StatusOK).JSON(loginResponse{
+			MfaRequired: true,
+			MfaToken:    tokens.MfaToken,
+			Success:     true,
+			Message:     "second factor required",
+		})
+	}
 	return c.Status(fiber.StatusOK).JSON(loginResponse{
-		Token:   token,
-		Success: true,
-		Message: "Found Successfully",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Success:      true,
+		Message:      "Found Successfully",
 	})
 }
 
@@ -208,14 +353,17 @@ type userDetailResponse struct {
 	Success bool        `json:"success"`
 }
 type userDetail struct {
-	FirstName        string `json:"firstName"`
-	LastName         string `json:"lastName"`
-	UserName         string `json:"userName"`
-	Bio              string `json:"bio"`
-	ProfilePic       string `json:"profilePic"`
-	IsMobileVerified bool   `json:"isMobileVerified"`
-	IsComplete       bool   `json:"isComplete"`
-	IsFollowing      bool   `json:"isFollowing"`
+	FirstName        string        `json:"firstName"`
+	LastName         string        `json:"lastName"`
+	UserName         string        `json:"userName"`
+	Bio              string        `json:"bio"`
+	ProfilePic       string        `json:"profilePic"`
+	ProfileMedia     *models.Media `json:"profileMedia,omitempty"`
+	IsMobileVerified bool          `json:"isMobileVerified"`
+	IsComplete       bool          `json:"isComplete"`
+	IsFollowing      bool          `json:"isFollowing"`
+	IsPrivate        bool          `json:"isPrivate"`
+	IsRequested      bool          `json:"isRequested"`
 }
 
 func (u *UserController) getUserDetail(c *fiber.Ctx) error {
@@ -232,6 +380,7 @@ func (u *UserController) getUserDetail(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
+	user.ProfileMedia.SignUrls(c.Context(), u.blobs)
 	return c.Status(fiber.StatusOK).JSON(userDetailResponse{
 		Data: &userDetail{
 			FirstName:        user.FirstName,
@@ -239,8 +388,10 @@ func (u *UserController) getUserDetail(c *fiber.Ctx) error {
 			UserName:         user.UserName,
 			Bio:              user.Bio,
 			ProfilePic:       user.ProfilePic,
+			ProfileMedia:     user.ProfileMedia,
 			IsMobileVerified: user.IsMobileVerified,
 			IsComplete:       user.IsComplete,
+			IsPrivate:        user.IsPrivate,
 		},
 		Message: "found successfully",
 		Success: true,
@@ -294,6 +445,12 @@ func (u *UserController) updateUserDetail(c *fiber.Ctx) error {
 	}
 
 	message, err := u.storage.updateUser(userName, updateFields, c.Context())
+	if errors.Is(err, errInvalidUpload) {
+		return c.Status(fiber.StatusBadRequest).JSON(updateUserDetailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(updateUserDetailResponse{
 			Message: "Update failed",
@@ -340,9 +497,13 @@ func (u *UserController) updateUserMobile(c *fiber.Ctx) error {
 		return errors.New("not able to covert")
 	}
 
-	generatedOtp := otp.EncodeToString(6)
-
-	message, err := u.storage.updateMobile(userName, req.Mobile, generatedOtp, c.Context())
+	message, err := u.storage.updateMobile(userName, req.Mobile, c.Context())
+	if errors.Is(err, errOtpCooldown) || errors.Is(err, errOtpLocked) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(updateUserDetailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(updateUserDetailResponse{
 			Message: "Update failed",
@@ -367,8 +528,26 @@ type getProfileUploadKeyResponse struct {
 }
 
 func (u *UserController) getProfileUploadKey(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(getProfileUploadKeyResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
 	id := uuid.New()
-	url, err := signedurl.GetSignedUrl(id.String())
+	url, err := u.blobs.PresignPut(c.Context(), id.String(), blobstore.UploadUrlTTL)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getProfileUploadKeyResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	err = u.storage.recordProfileUpload(userName, id.String(), c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(getProfileUploadKeyResponse{
 			Message: "something went wrong",
@@ -412,14 +591,18 @@ func (u *UserController) getUserDetailByUserName(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
+	user.ProfileMedia.SignUrls(c.Context(), u.blobs)
 	return c.Status(fiber.StatusOK).JSON(userDetailResponse{
 		Data: &userDetail{
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			UserName:    user.UserName,
-			Bio:         user.Bio,
-			ProfilePic:  user.ProfilePic,
-			IsFollowing: user.IsFollowing,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			UserName:     user.UserName,
+			Bio:          user.Bio,
+			ProfilePic:   user.ProfilePic,
+			ProfileMedia: user.ProfileMedia,
+			IsFollowing:  user.IsFollowing,
+			IsPrivate:    user.IsPrivate,
+			IsRequested:  user.IsRequested,
 		},
 		Message: "found successfully",
 		Success: true,
@@ -430,6 +613,7 @@ type markUserFavTagsRequest struct {
 	Tags []string `json:"tags"`
 }
 type markUserFavTagsResponse struct {
+	Token   string `json:"token"`
 	Message string `json:"message"`
 	Success bool   `json:"success"`
 }
@@ -456,7 +640,9 @@ func (u *UserController) markUserFavTags(c *fiber.Ctx) error {
 		})
 	}
 
-	message, err := u.storage.markFavTags(userName, req.Tags, c.Context())
+	sessionId, _ := c.Locals("sessionId").(string)
+
+	token, err := u.storage.markFavTags(userName, sessionId, req.Tags, c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(markUserFavTagsResponse{
 			Message: "somthing went wrong",
@@ -465,7 +651,8 @@ func (u *UserController) markUserFavTags(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(markUserFavTagsResponse{
-		Message: message,
+		Token:   token,
+		Message: "marked successfully",
 		Success: true,
 	})
 }
@@ -500,7 +687,8 @@ func (u *UserController) followUser(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
-	message, err := u.storage.follow(userName, req.UserName, c.Context())
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.follow(userName, target, c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(followUserResponse{
 			Message: err.Error(),
@@ -535,7 +723,8 @@ func (u *UserController) unfollowUser(c *fiber.Ctx) error {
 			Success: false,
 		})
 	}
-	message, err := u.storage.unfollow(userName, req.UserName, c.Context())
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.unfollow(userName, target, c.Context())
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(followUserResponse{
 			Message: err.Error(),
@@ -710,3 +899,1681 @@ func (u *UserController) getUserFollowings(c *fiber.Ctx) error {
 		Success: true,
 	})
 }
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+type forgotPasswordResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) forgotPassword(c *fiber.Ctx) error {
+	var req forgotPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(forgotPasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(forgotPasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.forgotPassword(req.Email, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(forgotPasswordResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(forgotPasswordResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type resetPasswordRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Otp      string `json:"otp" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+type resetPasswordResponse struct {
+	Reasons []password.Violation `json:"reasons,omitempty"`
+	Message string               `json:"message"`
+	Success bool                 `json:"success"`
+}
+
+func (u *UserController) resetPassword(c *fiber.Ctx) error {
+	var req resetPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(resetPasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(resetPasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.resetPassword(req.Email, req.Otp, req.Password, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(resetPasswordResponse{
+			Reasons: policyErr.Violations,
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(resetPasswordResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resetPasswordResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+type changePasswordResponse struct {
+	Token        string               `json:"token"`
+	RefreshToken string               `json:"refreshToken"`
+	Reasons      []password.Violation `json:"reasons,omitempty"`
+	Message      string               `json:"message"`
+	Success      bool                 `json:"success"`
+}
+
+func (u *UserController) changePassword(c *fiber.Ctx) error {
+	var req changePasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changePasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changePasswordResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(changePasswordResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.changePassword(userName, req.CurrentPassword, req.NewPassword, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(changePasswordResponse{
+			Reasons: policyErr.Violations,
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changePasswordResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(changePasswordResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "Password changed successfully",
+		Success:      true,
+	})
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+type refreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	Message      string `json:"message"`
+	Success      bool   `json:"success"`
+}
+
+func (u *UserController) refreshToken(c *fiber.Ctx) error {
+	var req refreshTokenRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(refreshTokenResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(refreshTokenResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.refreshSession(req.RefreshToken, c.Context())
+	if errors.Is(err, errSessionInvalid) {
+		return c.Status(fiber.StatusUnauthorized).JSON(refreshTokenResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(refreshTokenResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(refreshTokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "refreshed successfully",
+		Success:      true,
+	})
+}
+
+type logoutResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) logout(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+	sessionId, sessionErr := c.Locals("sessionId").(string)
+
+	if !cnvErr || !sessionErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(logoutResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.revokeSession(userName, sessionId, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(logoutResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(logoutResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) logoutAll(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(logoutResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.revokeAllSessions(userName, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(logoutResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(logoutResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) getJwks(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(jwtclaim.PublicJWKS())
+}
+
+type updateUserRoleRequest struct {
+	UserName string `json:"userName" validate:"required"`
+	Role     string `json:"role" validate:"required"`
+}
+type updateUserRoleResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) updateUserRole(c *fiber.Ctx) error {
+	var req updateUserRoleRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateUserRoleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil || !jwtclaim.Role(req.Role).IsValid() {
+		return c.Status(fiber.StatusBadRequest).JSON(updateUserRoleResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.updateRole(req.UserName, jwtclaim.Role(req.Role), c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updateUserRoleResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updateUserRoleResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type oidcLoginRequest struct {
+	IdToken   string `json:"idToken" validate:"required"`
+	UserName  string `json:"userName"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+type oidcLoginResponse struct {
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refreshToken"`
+	IsNewUser     bool     `json:"isNewUser"`
+	MfaRequired   bool     `json:"mfaRequired"`
+	MfaToken      string   `json:"mfaToken,omitempty"`
+	MissingFields []string `json:"missingFields,omitempty"`
+	Message       string   `json:"message"`
+	Success       bool     `json:"success"`
+}
+
+func (u *UserController) oidcLogin(c *fiber.Ctx) error {
+	var req oidcLoginRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(oidcLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(oidcLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	identity, err := u.verifier.Verify(c.Context(), c.Params("provider"), req.IdToken)
+	if errors.Is(err, oidc.ErrUnknownProvider) {
+		return c.Status(fiber.StatusNotFound).JSON(oidcLoginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(oidcLoginResponse{
+			Message: oidc.ErrInvalidToken.Error(),
+			Success: false,
+		})
+	}
+
+	tokens, isNewUser, err := u.storage.oidcLogin(identity, req.UserName, req.FirstName, req.LastName, c.Context())
+
+	var missingErr *missingFieldsError
+	if errors.As(err, &missingErr) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(oidcLoginResponse{
+			MissingFields: missingErr.fields,
+			Message:       err.Error(),
+			Success:       false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(oidcLoginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	if tokens.MfaToken != "" {
+		return c.Status(fiber.StatusOK).JSON(oidcLoginResponse{
+			MfaRequired: true,
+			MfaToken:    tokens.MfaToken,
+			Message:     "second factor required",
+			Success:     true,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(oidcLoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IsNewUser:    isNewUser,
+		Message:      "logged in successfully",
+		Success:      true,
+	})
+}
+
+// reauthenticateRequest proves the caller still holds the account before a
+// sensitive action, by the current password or a second factor code.
+type reauthenticateRequest struct {
+	Password string `json:"password" validate:"required_without=Code"`
+	Code     string `json:"code" validate:"required_without=Password"`
+}
+
+type exportUserDataResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) exportUserData(c *fiber.Ctx) error {
+	var req reauthenticateRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(exportUserDataResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(exportUserDataResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(exportUserDataResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	data, err := u.storage.exportData(userName, req.Password, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errIncorrectPassword) {
+		return c.Status(fiber.StatusUnauthorized).JSON(exportUserDataResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errOtpInvalid) || errors.Is(err, errOtpLocked) || errors.Is(err, errTotpNotEnabled) {
+		return c.Status(otpErrorStatus(err)).JSON(exportUserDataResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(exportUserDataResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	if c.Query("format") != "zip" {
+		c.Attachment(userName + "-export.json")
+		return c.Status(fiber.StatusOK).JSON(data)
+	}
+
+	jsonData, _ := json.MarshalIndent(data, "", "  ")
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	file, err := archive.Create("export.json")
+	if err == nil {
+		_, err = file.Write(jsonData)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(exportUserDataResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	c.Attachment(userName + "-export.zip")
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
+
+type deleteAccountResponse struct {
+	DeleteAfter string `json:"deleteAfter"`
+	Message     string `json:"message"`
+	Success     bool   `json:"success"`
+}
+
+func (u *UserController) deleteAccount(c *fiber.Ctx) error {
+	var req reauthenticateRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteAccountResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(deleteAccountResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(deleteAccountResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	deleteAfter, err := u.storage.requestDeletion(userName, req.Password, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errIncorrectPassword) {
+		return c.Status(fiber.StatusUnauthorized).JSON(deleteAccountResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errOtpInvalid) || errors.Is(err, errOtpLocked) || errors.Is(err, errTotpNotEnabled) {
+		return c.Status(otpErrorStatus(err)).JSON(deleteAccountResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(deleteAccountResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deleteAccountResponse{
+		DeleteAfter: deleteAfter.Format(time.RFC3339),
+		Message:     "account scheduled for deletion",
+		Success:     true,
+	})
+}
+
+func (u *UserController) cancelAccountDeletion(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(deleteAccountResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.cancelDeletion(userName, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(deleteAccountResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deleteAccountResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type mfaLoginRequest struct {
+	MfaToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+func (u *UserController) mfaLogin(c *fiber.Ctx) error {
+	var req mfaLoginRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.completeMfaLogin(req.MfaToken, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errSessionInvalid) {
+		return c.Status(fiber.StatusUnauthorized).JSON(loginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(loginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(loginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Success:      true,
+		Message:      "logged in successfully",
+	})
+}
+
+type setupTotpResponse struct {
+	Secret  string `json:"secret"`
+	Uri     string `json:"uri"`
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) setupTotp(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(setupTotpResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	secret, uri, err := u.storage.setupTotp(userName, c.Context())
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(setupTotpResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(setupTotpResponse{
+		Secret:  secret,
+		Uri:     uri,
+		Message: "scan the uri with an authenticator app and confirm a code",
+		Success: true,
+	})
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+type backupCodesResponse struct {
+	BackupCodes []string `json:"backupCodes"`
+	Message     string   `json:"message"`
+	Success     bool     `json:"success"`
+}
+
+func (u *UserController) confirmTotp(c *fiber.Ctx) error {
+	var req totpCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(backupCodesResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(backupCodesResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(backupCodesResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	codes, err := u.storage.confirmTotp(userName, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(backupCodesResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(backupCodesResponse{
+		BackupCodes: codes,
+		Message:     "two-factor authentication enabled",
+		Success:     true,
+	})
+}
+
+func (u *UserController) regenerateBackupCodes(c *fiber.Ctx) error {
+	var req totpCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(backupCodesResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(backupCodesResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(backupCodesResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	codes, err := u.storage.regenerateBackupCodes(userName, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(backupCodesResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(backupCodesResponse{
+		BackupCodes: codes,
+		Message:     "backup codes regenerated",
+		Success:     true,
+	})
+}
+
+type disableTotpResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) disableTotp(c *fiber.Ctx) error {
+	var req totpCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(disableTotpResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(disableTotpResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(disableTotpResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.disableTotp(userName, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(disableTotpResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(disableTotpResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type getFollowRequestsResponse struct {
+	Data    []followRequest `json:"data"`
+	Message string          `json:"message"`
+	Success bool            `json:"success"`
+}
+
+func (u *UserController) getFollowRequests(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(getFollowRequestsResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	result, err := u.storage.followRequests(userName, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getFollowRequestsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getFollowRequestsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type followRequestRequest struct {
+	UserName string `json:"userName" validate:"required"`
+}
+type followRequestResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) approveFollowRequest(c *fiber.Ctx) error {
+	var req followRequestRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(followRequestResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(followRequestResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(followRequestResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.approveFollowRequest(userName, target, c.Context())
+	if errors.Is(err, errFollowRequestNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(followRequestResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(followRequestResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(followRequestResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) denyFollowRequest(c *fiber.Ctx) error {
+	var req followRequestRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(followRequestResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(followRequestResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(followRequestResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.denyFollowRequest(userName, target, c.Context())
+	if errors.Is(err, errFollowRequestNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(followRequestResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(followRequestResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(followRequestResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type updatePrivacyRequest struct {
+	IsPrivate *bool `json:"isPrivate" validate:"required"`
+}
+type updatePrivacyResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) updatePrivacy(c *fiber.Ctx) error {
+	var req updatePrivacyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updatePrivacyResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(updatePrivacyResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(updatePrivacyResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.updatePrivacy(userName, *req.IsPrivate, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(updatePrivacyResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(updatePrivacyResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type restrictUserRequest struct {
+	UserName string `json:"userName" validate:"required"`
+}
+type restrictUserResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) blockUser(c *fiber.Ctx) error {
+	var req restrictUserRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(restrictUserResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.block(userName, target, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(restrictUserResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) unblockUser(c *fiber.Ctx) error {
+	var req restrictUserRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(restrictUserResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.unblock(userName, target, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(restrictUserResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) muteUser(c *fiber.Ctx) error {
+	var req restrictUserRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(restrictUserResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.mute(userName, target, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(restrictUserResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) unmuteUser(c *fiber.Ctx) error {
+	var req restrictUserRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(restrictUserResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	target := u.storage.currentUserName(req.UserName, c.Context())
+	message, err := u.storage.unmute(userName, target, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(restrictUserResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(restrictUserResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type getRestrictedUsersResponse struct {
+	Data    []restrictedUser `json:"data"`
+	Message string           `json:"message"`
+	Success bool             `json:"success"`
+}
+
+func (u *UserController) getBlockedUsers(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(getRestrictedUsersResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	result, err := u.storage.blockedUsers(userName, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getRestrictedUsersResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getRestrictedUsersResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+func (u *UserController) getMutedUsers(c *fiber.Ctx) error {
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(getRestrictedUsersResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	result, err := u.storage.mutedUsers(userName, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getRestrictedUsersResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getRestrictedUsersResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type getSecurityEventsResponse struct {
+	Data    []security.Event `json:"data"`
+	Message string           `json:"message"`
+	Success bool             `json:"success"`
+}
+
+func (u *UserController) getSecurityEvents(c *fiber.Ctx) error {
+	cursor := c.Query("cursor")
+
+	result, err := u.security.Events(c.Context(), cursor)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(getSecurityEventsResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(getSecurityEventsResponse{
+		Data:    result,
+		Message: "found successfully",
+		Success: true,
+	})
+}
+
+type requestLoginOtpRequest struct {
+	Mobile string `json:"mobile" validate:"required"`
+}
+type requestLoginResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) requestLoginOtp(c *fiber.Ctx) error {
+	var req requestLoginOtpRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(requestLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(requestLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.requestLoginOtp(req.Mobile, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(requestLoginResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(requestLoginResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type loginWithOtpRequest struct {
+	Mobile string `json:"mobile" validate:"required"`
+	Otp    string `json:"otp" validate:"required"`
+}
+
+func (u *UserController) loginWithOtp(c *fiber.Ctx) error {
+	var req loginWithOtpRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.loginWithOtp(req.Mobile, req.Otp, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(loginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if tokens.MfaToken != "" {
+		return c.Status(fiber.StatusOK).JSON(loginResponse{
+			MfaRequired: true,
+			MfaToken:    tokens.MfaToken,
+			Success:     true,
+			Message:     "second factor required",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(loginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Success:      true,
+		Message:      "logged in successfully",
+	})
+}
+
+type requestLoginLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (u *UserController) requestLoginLink(c *fiber.Ctx) error {
+	var req requestLoginLinkRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(requestLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(requestLoginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.requestLoginLink(req.Email, c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(requestLoginResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(requestLoginResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type loginWithLinkRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (u *UserController) loginWithLink(c *fiber.Ctx) error {
+	var req loginWithLinkRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(loginResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	tokens, err := u.storage.loginWithLink(req.Token, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if err != nil {
+		return c.Status(otpErrorStatus(err)).JSON(loginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if tokens.MfaToken != "" {
+		return c.Status(fiber.StatusOK).JSON(loginResponse{
+			MfaRequired: true,
+			MfaToken:    tokens.MfaToken,
+			Success:     true,
+			Message:     "second factor required",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(loginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Success:      true,
+		Message:      "logged in successfully",
+	})
+}
+
+type changeUserNameRequest struct {
+	UserName string `json:"userName" validate:"required"`
+}
+type changeUserNameResponse struct {
+	UserName string `json:"userName,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Message  string `json:"message"`
+	Success  bool   `json:"success"`
+}
+
+func (u *UserController) changeUserName(c *fiber.Ctx) error {
+	var req changeUserNameRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeUserNameResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeUserNameResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+	sessionId, sessionErr := c.Locals("sessionId").(string)
+
+	if !cnvErr || !sessionErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(changeUserNameResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	token, err := u.storage.changeUserName(userName, req.UserName, sessionId, c.Context())
+	if errors.Is(err, errUserNameCooldown) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(changeUserNameResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errUserNameTaken) {
+		return c.Status(fiber.StatusConflict).JSON(changeUserNameResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeUserNameResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(changeUserNameResponse{
+		UserName: req.UserName,
+		Token:    token,
+		Message:  "username changed successfully",
+		Success:  true,
+	})
+}
+
+type changeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required_without=Code"`
+	Code     string `json:"code" validate:"required_without=Password"`
+}
+type changeEmailResponse struct {
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+func (u *UserController) requestEmailChange(c *fiber.Ctx) error {
+	var req changeEmailRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(changeEmailResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.requestEmailChange(userName, req.Email, req.Password, req.Code, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errIncorrectPassword) {
+		return c.Status(fiber.StatusUnauthorized).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errOtpCooldown) || errors.Is(err, errOtpLocked) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errEmailTaken) {
+		return c.Status(fiber.StatusConflict).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(changeEmailResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+func (u *UserController) confirmEmailChange(c *fiber.Ctx) error {
+	var req verifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	localData := c.Locals("userName")
+	userName, cnvErr := localData.(string)
+
+	if !cnvErr {
+		return c.Status(fiber.StatusInternalServerError).JSON(changeEmailResponse{
+			Message: "something went wrong",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.confirmEmailChange(userName, req.Otp, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errOtpCooldown) || errors.Is(err, errOtpLocked) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if errors.Is(err, errEmailTaken) {
+		return c.Status(fiber.StatusConflict).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(changeEmailResponse{
+		Message: message,
+		Success: true,
+	})
+}
+
+type cancelEmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Otp   string `json:"otp" validate:"required"`
+}
+
+func (u *UserController) cancelEmailChange(c *fiber.Ctx) error {
+	var req cancelEmailChangeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: "Invalid request body",
+			Success: false,
+		})
+	}
+
+	message, err := u.storage.cancelEmailChange(req.Email, req.Otp, c.Context())
+	if isRejectedAttempt(err) {
+		middleware.RejectAttempt(c)
+	}
+	if errors.Is(err, errOtpLocked) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(changeEmailResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(changeEmailResponse{
+		Message: message,
+		Success: true,
+	})
+}
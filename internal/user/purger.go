@@ -0,0 +1,36 @@
+package user
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartAccountPurger periodically deletes accounts whose deletion grace
+// period is over. The returned function stops it.
+func StartAccountPurger(storage *UserStorage, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := storage.purgeDeletedAccounts(ctx)
+				if err != nil {
+					log.Printf("account purge failed: %v", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("purged %d deleted accounts", purged)
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
@@ -3,38 +3,88 @@ package user
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/zone/IStyle/internal/middleware"
+	"github.com/zone/IStyle/pkg/jwtclaim"
 )
 
 func AddUserRoutes(app *fiber.App, middleware *middleware.AuthMiddleware, controller *UserController) {
+	app.Get("/.well-known/jwks.json", controller.getJwks)
+
 	auth := app.Group("/auth")
 
 	// add routes here
 	auth.Post("/sign-up", controller.register)
 	auth.Post("/login", controller.loginUser)
+	auth.Post("/login/2fa", middleware.Throttle, controller.mfaLogin)
+	auth.Post("/login/otp", controller.requestLoginOtp)
+	auth.Post("/login/otp/verify", middleware.Throttle, controller.loginWithOtp)
+	auth.Post("/login/link", controller.requestLoginLink)
+	auth.Post("/login/link/verify", middleware.Throttle, controller.loginWithLink)
+	auth.Post("/password/forgot", controller.forgotPassword)
+	auth.Post("/password/reset", middleware.Throttle, controller.resetPassword)
+	auth.Post("/token/refresh", controller.refreshToken)
+	auth.Post("/oidc/:provider", controller.oidcLogin)
+	auth.Post("/email/cancel", middleware.Throttle, controller.cancelEmailChange)
+
+	emailVerified := middleware.RequireState(jwtclaim.StateEmailVerified)
+	mobileVerified := middleware.RequireState(jwtclaim.StateMobileVerified)
+	onboarded := middleware.RequireState(jwtclaim.StateOnboarded)
+
+	// sessions
+	logout := auth.Group("/logout", middleware.VerifyOtpToken)
+	logout.Post("/", controller.logout)
+	logout.Post("/all", controller.logoutAll)
 
 	// verify Email token
 	verifyEmail := auth.Group("/verify/email", middleware.VerifyOtpToken)
-	verifyEmail.Post("/", controller.verifyEmail)
+	verifyEmail.Post("/", middleware.Throttle, controller.verifyEmail)
+	verifyEmail.Post("/resend", controller.resendEmailOtp)
 
 	// update Mobile
-	updateMobile := auth.Group("/update/mobile", middleware.VerifyOtpToken)
+	updateMobile := auth.Group("/update/mobile", middleware.VerifyOtpToken, emailVerified)
 	updateMobile.Post("/", controller.updateUserMobile)
 
 	// verify Mobile token
-	verifyMobile := auth.Group("/verify/mobile", middleware.VerifyOtpToken)
-	verifyMobile.Post("/", controller.verifyMobile)
-
-	// user
-	user := auth.Group("/user", middleware.VerifyUser)
-	user.Get("/", controller.getUserDetail)
-	user.Get("/picture/url", controller.getProfileUploadKey)
-	user.Post("/update", controller.updateUserDetail)
-	user.Get("/:userName", controller.getUserDetailByUserName)
-	user.Post("/fav/tag", controller.markUserFavTags)
-	user.Post("/follow", controller.followUser)
-	user.Post("/unfollow", controller.unfollowUser)
-	user.Get("/followers", controller.getFollowers)
-	user.Get("/followers/:userName", controller.getUserFollowers)
-	user.Get("/followings", controller.getFollowings)
-	user.Get("/followings/:userName", controller.getUserFollowings)
+	verifyMobile := auth.Group("/verify/mobile", middleware.VerifyOtpToken, emailVerified)
+	verifyMobile.Post("/", middleware.Throttle, controller.verifyMobile)
+	verifyMobile.Post("/resend", controller.resendMobileOtp)
+
+	// user, profile setup is part of onboarding so it only needs a verified mobile
+	user := auth.Group("/user", middleware.VerifyOtpToken)
+	user.Get("/", mobileVerified, controller.getUserDetail)
+	user.Get("/picture/url", mobileVerified, controller.getProfileUploadKey)
+	user.Post("/update", mobileVerified, controller.updateUserDetail)
+	user.Post("/username", mobileVerified, controller.changeUserName)
+	user.Post("/email", mobileVerified, middleware.Throttle, controller.requestEmailChange)
+	user.Post("/email/verify", mobileVerified, middleware.Throttle, controller.confirmEmailChange)
+	user.Post("/password/change", middleware.Throttle, controller.changePassword)
+	user.Post("/export", middleware.Throttle, controller.exportUserData)
+	user.Post("/delete", middleware.Throttle, controller.deleteAccount)
+	user.Post("/delete/cancel", controller.cancelAccountDeletion)
+	user.Post("/2fa/setup", controller.setupTotp)
+	user.Post("/2fa/confirm", middleware.Throttle, controller.confirmTotp)
+	user.Post("/2fa/disable", middleware.Throttle, controller.disableTotp)
+	user.Post("/2fa/backup-codes", middleware.Throttle, controller.regenerateBackupCodes)
+	user.Get("/follow-requests", onboarded, controller.getFollowRequests)
+	user.Get("/blocked", onboarded, controller.getBlockedUsers)
+	user.Get("/muted", onboarded, controller.getMutedUsers)
+	user.Get("/:userName", onboarded, middleware.CheckUserNameExists, middleware.CheckNotBlocked, controller.getUserDetailByUserName)
+	user.Post("/fav/tag", mobileVerified, controller.markUserFavTags)
+	user.Post("/follow", onboarded, controller.followUser)
+	user.Post("/unfollow", onboarded, controller.unfollowUser)
+	user.Get("/followers", onboarded, controller.getFollowers)
+	user.Get("/followers/:userName", onboarded, middleware.CheckUserNameExists, middleware.CheckNotBlocked, middleware.CanViewProfile, controller.getUserFollowers)
+	user.Get("/followings", onboarded, controller.getFollowings)
+	user.Get("/followings/:userName", onboarded, middleware.CheckUserNameExists, middleware.CheckNotBlocked, middleware.CanViewProfile, controller.getUserFollowings)
+	user.Post("/privacy", onboarded, controller.updatePrivacy)
+	user.Post("/follow-requests/approve", onboarded, controller.approveFollowRequest)
+	user.Post("/follow-requests/deny", onboarded, controller.denyFollowRequest)
+	user.Post("/block", onboarded, controller.blockUser)
+	user.Post("/unblock", onboarded, controller.unblockUser)
+	user.Post("/mute", onboarded, controller.muteUser)
+	user.Post("/unmute", onboarded, controller.unmuteUser)
+
+	// admin
+	admin := auth.Group("/admin", middleware.VerifyUser, middleware.RequireRole(jwtclaim.RoleAdmin))
+	admin.Post("/user/role", controller.updateUserRole)
+	admin.Get("/security/events", controller.getSecurityEvents)
 }
@@ -4,105 +4,107 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"github.com/zone/IStyle/internal/models"
 	"github.com/zone/IStyle/pkg/hash"
 	"github.com/zone/IStyle/pkg/jwtclaim"
+	"github.com/zone/IStyle/pkg/notifier"
+	"github.com/zone/IStyle/pkg/oidc"
 	"github.com/zone/IStyle/pkg/otp"
+	"github.com/zone/IStyle/pkg/password"
+	"github.com/zone/IStyle/pkg/totp"
 )
 
 type UserStorage struct {
-	db     neo4j.DriverWithContext
-	dbName string
+	db             neo4j.DriverWithContext
+	dbName         string
+	notifier       *notifier.Dispatcher
+	passwordPolicy *password.Policy
+	// loginLinkUrl is the page login links point to, the token is added as
+	// the token query parameter
+	loginLinkUrl string
 }
 
-func NewUserStorage(db neo4j.DriverWithContext, dbName string) *UserStorage {
+func NewUserStorage(db neo4j.DriverWithContext, dbName string, notifier *notifier.Dispatcher, passwordPolicy *password.Policy, loginLinkUrl string) *UserStorage {
 	return &UserStorage{
-		db:     db,
-		dbName: dbName,
+		db:             db,
+		dbName:         dbName,
+		notifier:       notifier,
+		passwordPolicy: passwordPolicy,
+		loginLinkUrl:   loginLinkUrl,
 	}
 }
 
-func (u *UserStorage) signUp(firstName string, lastName string, userName string, email string, password string, ctx context.Context) (string, error) {
+func (u *UserStorage) signUp(firstName string, lastName string, userName string, email string, password string, ctx context.Context) (*authTokens, error) {
 	now := time.Now()
 	isEmailExist := u.emailExists(email, ctx)
 
 	if isEmailExist {
-		return "", errors.New("email already exists")
+		return nil, errEmailTaken
 	}
-	isUserNameExist := u.userNameExists(userName, ctx)
+	isUserNameExist := u.userNameExists(userName, ctx) || u.userNameReserved(userName, ctx)
 
 	if isUserNameExist {
-		return "", errors.New("username already exists")
+		return nil, errUserNameTaken
+	}
+
+	if err := u.passwordPolicy.Check(password, userName, email); err != nil {
+		return nil, err
 	}
 
 	hashedPassword, err := hash.HashPassword(password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
-	generatedOtp := otp.EncodeToString(6)
 	_, err = session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
 			return tx.Run(ctx,
-				"CREATE (:User {firstName: $firstName, lastName: $lastName, userName: $userName, email: $email, password: $password, emailOtp:$emailOtp, isEmailVerified:$isEmailVerified, isMobileVerified:$isMobileVerified, isComplete:$isComplete, created_at:datetime($createdAt), updated_at:datetime($updatedAt)})",
-				map[string]any{"firstName": firstName, "lastName": lastName, "userName": userName, "email": email, "password": hashedPassword, "emailOtp": generatedOtp, "isEmailVerified": false, "isMobileVerified": false, "isComplete": false, "createdAt": now.Format(time.RFC3339), "updatedAt": now.Format(time.RFC3339)})
+				"CREATE (:User {firstName: $firstName, lastName: $lastName, userName: $userName, email: $email, password: $password, isEmailVerified:$isEmailVerified, isMobileVerified:$isMobileVerified, isComplete:$isComplete, role:$role, created_at:datetime($createdAt), updated_at:datetime($updatedAt)})",
+				map[string]any{"firstName": firstName, "lastName": lastName, "userName": userName, "email": email, "password": hashedPassword, "isEmailVerified": false, "isMobileVerified": false, "isComplete": false, "role": string(jwtclaim.RoleUser), "createdAt": now.Format(time.RFC3339), "updatedAt": now.Format(time.RFC3339)})
 		})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	verifyToken, err := jwtclaim.CreateJwtToken(userName, false)
+	// the account exists at this point, a failed delivery should not fail the
+	// sign up since the otp can be resent
+	generatedOtp, err := u.issueOtp(userName, emailOtpPurpose, ctx)
+	if err == nil {
+		err = u.notifier.Notify(ctx, notifier.VerifyEmailOtp, email, notifier.OtpData{Name: firstName, Otp: generatedOtp, ExpiresIn: otpTTL})
+	}
 	if err != nil {
-		return "", err
+		log.Printf("failed to send email otp to %s: %v", userName, err)
 	}
 
-	return verifyToken, nil
+	return u.createSession(userName, ctx)
 }
 
-func (u *UserStorage) verifyEmail(otp string, userName string, ctx context.Context) (string, error) {
-	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
-	defer session.Close(ctx)
-
-	result, err := session.ExecuteRead(ctx,
-		func(tx neo4j.ManagedTransaction) (any, error) {
-			result, err := tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) RETURN u.emailOtp AS otp",
-				map[string]interface{}{
-					"userName": userName,
-				},
-			)
-			if err != nil {
-				return "", err
-			}
-
-			record, err := result.Single(ctx)
-			if err != nil {
-				return "", err
-			}
-
-			otp, _ := record.Get("otp")
-
-			return otp.(string), nil
-		})
+func (u *UserStorage) verifyEmail(otp string, userName string, sessionId string, ctx context.Context) (string, error) {
+	err := u.consumeOtp(userName, emailOtpPurpose, otp, ctx)
 	if err != nil {
 		return "", err
 	}
 
-	if result != otp {
-		return "", errors.New("invalid otp")
-	}
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
 
 	_, err = session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
 			return tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) SET u.isEmailVerified = true",
+				"MATCH (u:User {userName:$userName}) SET u.isEmailVerified = true REMOVE u.emailOtp",
 				map[string]interface{}{
 					"userName": userName,
 				},
@@ -112,50 +114,22 @@ func (u *UserStorage) verifyEmail(otp string, userName string, ctx context.Conte
 	if err != nil {
 		return "", err
 	}
-	verifyToken, err := jwtclaim.CreateJwtToken(userName, false)
-	if err != nil {
-		return "", err
-	}
-	return verifyToken, nil
+	return u.accessToken(userName, sessionId, ctx)
 }
 
-func (u *UserStorage) verifyMobile(otp string, userName string, ctx context.Context) (string, error) {
-	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
-	defer session.Close(ctx)
-
-	result, err := session.ExecuteRead(ctx,
-		func(tx neo4j.ManagedTransaction) (any, error) {
-			result, err := tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) RETURN u.mobileOtp AS otp",
-				map[string]interface{}{
-					"userName": userName,
-				},
-			)
-			if err != nil {
-				return "", err
-			}
-
-			record, err := result.Single(ctx)
-			if err != nil {
-				return "", err
-			}
-
-			otp, _ := record.Get("otp")
-
-			return otp.(string), nil
-		})
+func (u *UserStorage) verifyMobile(otp string, userName string, sessionId string, ctx context.Context) (string, error) {
+	err := u.consumeOtp(userName, mobileOtpPurpose, otp, ctx)
 	if err != nil {
 		return "", err
 	}
 
-	if result != otp {
-		return "", errors.New("invalid otp")
-	}
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
 
 	_, err = session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
 			return tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) SET u.isMobileVerified = true",
+				"MATCH (u:User {userName:$userName}) SET u.isMobileVerified = true REMOVE u.mobileOtp",
 				map[string]interface{}{
 					"userName": userName,
 				},
@@ -166,27 +140,33 @@ func (u *UserStorage) verifyMobile(otp string, userName string, ctx context.Cont
 		return "", err
 	}
 
-	verifyToken, err := jwtclaim.CreateJwtToken(userName, true)
-	if err != nil {
-		return "", err
-	}
-	return verifyToken, nil
+	return u.accessToken(userName, sessionId, ctx)
 }
 
-func (u *UserStorage) login(email string, password string, ctx context.Context) (string, error) {
-	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
-	defer session.Close(ctx)
+// errInvalidCredentials is returned for unknown emails and wrong passwords
+// alike so login can't be used to find out which emails are registered.
+var errInvalidCredentials = errors.New("incorrect email or password")
 
-	isEmailExist := u.emailExists(email, ctx)
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
 
-	if !isEmailExist {
-		return "", errors.New("email not registered")
-	}
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hash.HashPassword(uuid.NewString())
+	})
+	return dummyHash
+}
 
-	result, _ := session.ExecuteRead(ctx,
+func (u *UserStorage) login(email string, password string, ctx context.Context) (*authTokens, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
 		func(tx neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := tx.Run(ctx,
-				"MATCH (u:User {email:$email}) RETURN u.userName AS userName, u.password AS password, u.isMobileVerified AS isMobileVerified",
+				"MATCH (u:User {email:$email}) RETURN u.userName AS userName, u.password AS password, u.isEmailVerified AS isEmailVerified, u.isMobileVerified AS isMobileVerified, u.isComplete AS isComplete",
 				map[string]interface{}{
 					"email": email,
 				},
@@ -200,29 +180,33 @@ func (u *UserStorage) login(email string, password string, ctx context.Context)
 			}
 			userName, _ := record.Get("userName")
 			password, _ := record.Get("password")
+			isEmailVerified, _ := record.Get("isEmailVerified")
 			isMobileVerified, _ := record.Get("isMobileVerified")
+			isComplete, _ := record.Get("isComplete")
+			// accounts created through an identity provider have no password
+			passwordHash, _ := password.(string)
 			return &models.User{
 				UserName:         userName.(string),
-				Password:         password.(string),
+				Password:         passwordHash,
+				IsEmailVerified:  isEmailVerified.(bool),
 				IsMobileVerified: isMobileVerified.(bool),
+				IsComplete:       isComplete.(bool),
 			}, nil
 		})
 
 	user, convErr := result.(*models.User)
 
-	if !convErr {
-		return "", errors.New("not able to covert")
+	if err != nil || !convErr {
+		// compare anyway so unknown emails take as long as wrong passwords
+		hash.CheckPasswordHash(password, dummyPasswordHash())
+		return nil, errInvalidCredentials
 	}
 
 	if !hash.CheckPasswordHash(password, user.Password) {
-		return "", errors.New("incorrect email or password")
+		return nil, errInvalidCredentials
 	}
 
-	verifyToken, err := jwtclaim.CreateJwtToken(user.UserName, user.IsMobileVerified)
-	if err != nil {
-		return "", err
-	}
-	return verifyToken, nil
+	return u.startSession(user.UserName, ctx)
 }
 
 func (u *UserStorage) getUser(userName string, ctx context.Context) (*models.User, error) {
@@ -232,7 +216,7 @@ func (u *UserStorage) getUser(userName string, ctx context.Context) (*models.Use
 	result, _ := session.ExecuteRead(ctx,
 		func(tx neo4j.ManagedTransaction) (interface{}, error) {
 			result, err := tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) RETURN u.firstName AS firstName, u.lastName AS lastName, u.userName AS userName, u.bio AS bio, u.profilePic AS profilePic, u.isMobileVerified AS isMobileVerified, u.isComplete AS isComplete",
+				"MATCH (u:User {userName:$userName}) RETURN u.firstName AS firstName, u.lastName AS lastName, u.userName AS userName, u.bio AS bio, u.profilePic AS profilePic, [(u)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:'image', .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height}][0] AS profileMedia, u.isMobileVerified AS isMobileVerified, u.isComplete AS isComplete, coalesce(u.isPrivate, false) AS isPrivate",
 				map[string]interface{}{
 					"userName": userName,
 				},
@@ -250,8 +234,10 @@ func (u *UserStorage) getUser(userName string, ctx context.Context) (*models.Use
 			userName, _ := record.Get("userName")
 			bio, _ := record.Get("bio")
 			profilePic, _ := record.Get("profilePic")
+			profileMedia, _ := record.Get("profileMedia")
 			isMobileVerified, _ := record.Get("isMobileVerified")
 			isComplete, _ := record.Get("isComplete")
+			isPrivate, _ := record.Get("isPrivate")
 			if bio == nil {
 				bio = ""
 			}
@@ -264,8 +250,10 @@ func (u *UserStorage) getUser(userName string, ctx context.Context) (*models.Use
 				UserName:         userName.(string),
 				Bio:              bio.(string),
 				ProfilePic:       profilePic.(string),
+				ProfileMedia:     toMedia(profileMedia),
 				IsMobileVerified: isMobileVerified.(bool),
 				IsComplete:       isComplete.(bool),
+				IsPrivate:        isPrivate.(bool),
 			}, nil
 		})
 
@@ -278,7 +266,7 @@ func (u *UserStorage) getUser(userName string, ctx context.Context) (*models.Use
 	return user, nil
 }
 
-func (u *UserStorage) updateMobile(userName string, mobile string, otp string, ctx context.Context) (string, error) {
+func (u *UserStorage) updateMobile(userName string, mobile string, ctx context.Context) (string, error) {
 	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
 
@@ -288,16 +276,21 @@ func (u *UserStorage) updateMobile(userName string, mobile string, otp string, c
 		return "", errors.New("mobile already exists")
 	}
 
+	// the otp is issued first so a cooldown leaves the current mobile as it is
+	generatedOtp, err := u.issueOtp(userName, mobileOtpPurpose, ctx)
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
-	_, err := session.ExecuteWrite(ctx,
+	_, err = session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
 			return tx.Run(ctx,
-				"MATCH (u:User {userName:$userName}) SET u.updated_at=datetime($updatedAt), u.mobile=$mobile, u.mobileOtp=$mobileOtp",
+				"MATCH (u:User {userName:$userName}) SET u.updated_at=datetime($updatedAt), u.mobile=$mobile REMOVE u.mobileOtp",
 				map[string]interface{}{
 					"userName":  userName,
 					"updatedAt": now.Format(time.RFC3339),
 					"mobile":    mobile,
-					"mobileOtp": otp,
 				},
 			)
 		},
@@ -306,9 +299,97 @@ func (u *UserStorage) updateMobile(userName string, mobile string, otp string, c
 		return "", err
 	}
 
+	err = u.notifier.Notify(ctx, notifier.VerifyMobileOtp, mobile, notifier.OtpData{Otp: generatedOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		return "", err
+	}
+
 	return "Update Successfully", nil
 }
 
+// toMedia converts the media map a query returned, nil stays nil.
+func toMedia(value any) *models.Media {
+	if value == nil {
+		return nil
+	}
+
+	jsonData, _ := json.Marshal(value)
+	var media models.Media
+	json.Unmarshal(jsonData, &media)
+
+	return &media
+}
+
+// profileUploadKeyTTL is how long an issued profile picture key can be used.
+const profileUploadKeyTTL = 24 * time.Hour
+
+var errInvalidUpload = errors.New("invalid upload")
+
+// recordProfileUpload remembers the profile picture key handed out to
+// userName so that only they can use it.
+func (u *UserStorage) recordProfileUpload(userName string, key string, ctx context.Context) error {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         CREATE (:Upload {key:$key, created_at:datetime($now), expires_at:datetime($now) + duration({seconds:$ttl})})-[:UPLOADED_BY]->(u)`,
+				map[string]interface{}{
+					"userName": userName,
+					"key":      key,
+					"now":      time.Now().Format(time.RFC3339),
+					"ttl":      int64(profileUploadKeyTTL.Seconds()),
+				},
+			)
+		})
+
+	return err
+}
+
+// setProfileMedia claims the upload of key and queues it for the image
+// pipeline in place of the previous picture, whose files are deleted. The
+// error rolls tx back when key was not issued to userName.
+func setProfileMedia(tx neo4j.ManagedTransaction, userName string, key string, now string, ctx context.Context) error {
+	result, err := tx.Run(ctx,
+		`MATCH (up:Upload {key:$key})-[:UPLOADED_BY]->(:User {userName:$userName})
+     WHERE up.expires_at > datetime($now)
+     DETACH DELETE up
+     RETURN count(up) AS claimed`,
+		map[string]interface{}{
+			"userName": userName,
+			"key":      key,
+			"now":      now,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return err
+	}
+	if claimed, _ := record.Get("claimed"); claimed != int64(1) {
+		return fmt.Errorf("%w: key %s was not issued for this user", errInvalidUpload, key)
+	}
+
+	_, err = tx.Run(ctx,
+		`MATCH (u:User {userName:$userName})
+     OPTIONAL MATCH (u)-[:HAS_MEDIA]->(old:Media)
+     FOREACH (key IN CASE WHEN old IS NULL THEN [] ELSE [old.key] END | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+     DETACH DELETE old
+     WITH DISTINCT u
+     CREATE (u)-[:HAS_MEDIA]->(:Media {key:$key, status:'pending', created_at:datetime($now)})`,
+		map[string]interface{}{
+			"userName": userName,
+			"key":      key,
+			"now":      now,
+		},
+	)
+	return err
+}
+
 func (u *UserStorage) updateUser(userName string, userField map[string]interface{}, ctx context.Context) (string, error) {
 	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
 	defer session.Close(ctx)
@@ -316,6 +397,12 @@ func (u *UserStorage) updateUser(userName string, userField map[string]interface
 	now := time.Now()
 	_, err := session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
+			if key, ok := userField["profilePic"].(string); ok {
+				if err := setProfileMedia(tx, userName, key, now.Format(time.RFC3339), ctx); err != nil {
+					return nil, err
+				}
+			}
+
 			return tx.Run(ctx,
 				"MATCH (u:User {userName:$userName}) SET u.updated_at=datetime($updatedAt), (CASE WHEN u.bio = null THEN u END).bio = $fields.bio, (CASE WHEN u.profilePic = null THEN u END).profilePic = $fields.profilePic, u+=$fields",
 				map[string]interface{}{
@@ -425,7 +512,8 @@ func (u *UserStorage) getUserByUserName(userName string, loggedInUser string, ct
 			result, err := tx.Run(ctx,
 				`MATCH (u:User {userName:$userName})
          MATCH (p:User{userName:$loggedInUser})
-         RETURN u.firstName AS firstName, u.lastName AS lastName, u.userName AS userName, u.bio AS bio, u.profilePic AS profilePic, EXISTS((p)-[:FOLLOWING]->(u)) AS isFollowing`,
+         RETURN u.firstName AS firstName, u.lastName AS lastName, u.userName AS userName, u.bio AS bio, u.profilePic AS profilePic, [(u)-[:HAS_MEDIA]->(m:Media) | m{image:m.key, type:'image', .status, .small, .medium, .large, .blurhash, dominantColor:m.dominant_color, .width, .height}][0] AS profileMedia,
+         EXISTS((p)-[:FOLLOWING]->(u)) AS isFollowing, coalesce(u.isPrivate, false) AS isPrivate, EXISTS((p)-[:FOLLOW_REQUEST]->(u)) AS isRequested`,
 				map[string]interface{}{
 					"userName":     userName,
 					"loggedInUser": loggedInUser,
@@ -444,7 +532,10 @@ func (u *UserStorage) getUserByUserName(userName string, loggedInUser string, ct
 			userName, _ := record.Get("userName")
 			bio, _ := record.Get("bio")
 			profilePic, _ := record.Get("profilePic")
+			profileMedia, _ := record.Get("profileMedia")
 			isFollowing, _ := record.Get("isFollowing")
+			isPrivate, _ := record.Get("isPrivate")
+			isRequested, _ := record.Get("isRequested")
 			if bio == nil {
 				bio = ""
 			}
@@ -452,12 +543,15 @@ func (u *UserStorage) getUserByUserName(userName string, loggedInUser string, ct
 				profilePic = ""
 			}
 			return &models.User{
-				FirstName:   firstName.(string),
-				LastName:    lastName.(string),
-				UserName:    userName.(string),
-				Bio:         bio.(string),
-				ProfilePic:  profilePic.(string),
-				IsFollowing: isFollowing.(bool),
+				FirstName:    firstName.(string),
+				LastName:     lastName.(string),
+				UserName:     userName.(string),
+				Bio:          bio.(string),
+				ProfilePic:   profilePic.(string),
+				ProfileMedia: toMedia(profileMedia),
+				IsFollowing:  isFollowing.(bool),
+				IsPrivate:    isPrivate.(bool),
+				IsRequested:  isRequested.(bool),
 			}, nil
 		})
 
@@ -470,7 +564,7 @@ func (u *UserStorage) getUserByUserName(userName string, loggedInUser string, ct
 	return user, nil
 }
 
-func (u *UserStorage) markFavTags(userName string, tags []string, ctx context.Context) (string, error) {
+func (u *UserStorage) markFavTags(userName string, sessionId string, tags []string, ctx context.Context) (string, error) {
 	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
 
@@ -491,18 +585,64 @@ func (u *UserStorage) markFavTags(userName string, tags []string, ctx context.Co
 		},
 	)
 	if err != nil {
-		return "something went wrong", err
+		return "", err
 	}
 
-	return "marked successfully", nil
+	// marking favourite tags completes onboarding
+	return u.accessToken(userName, sessionId, ctx)
 }
 
+// follow starts following a public account right away. Following a private
+// account only sends a follow request that its owner has to approve.
 func (u *UserStorage) follow(userName string, followingUserName string, ctx context.Context) (string, error) {
 	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
 	defer session.Close(ctx)
-	_, err := session.ExecuteWrite(ctx,
+
+	now := time.Now()
+	result, err := session.ExecuteWrite(ctx,
 		func(tx neo4j.ManagedTransaction) (any, error) {
-			return tx.Run(ctx,
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName}) 
+         MATCH (p:User {userName:$followingUserName})
+         RETURN coalesce(p.isPrivate, false) AS isPrivate, EXISTS((u)-[:FOLLOWING]->(p)) AS isFollowing, EXISTS((u)-[:BLOCKED]-(p)) AS isBlocked
+        `,
+				map[string]interface{}{
+					"userName":          userName,
+					"followingUserName": followingUserName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, errors.New("user does not exists")
+			}
+
+			if isBlocked, _ := record.Get("isBlocked"); isBlocked == true {
+				return nil, errors.New("user does not exists")
+			}
+			if isFollowing, _ := record.Get("isFollowing"); isFollowing == true {
+				return "already following", nil
+			}
+
+			if isPrivate, _ := record.Get("isPrivate"); isPrivate == true {
+				_, err = tx.Run(ctx,
+					`MATCH (u:User {userName:$userName}) 
+           MATCH (p:User {userName:$followingUserName})
+           MERGE (u)-[r:FOLLOW_REQUEST]->(p)
+           ON CREATE SET r.created_at=datetime($now)
+          `,
+					map[string]interface{}{
+						"userName":          userName,
+						"followingUserName": followingUserName,
+						"now":               now.Format(time.RFC3339),
+					},
+				)
+				return "follow request sent", err
+			}
+
+			_, err = tx.Run(ctx,
 				`MATCH (u:User {userName:$userName}) 
          MATCH (p:User {userName:$followingUserName})
          CREATE (u)-[:FOLLOWING]->(p)
@@ -512,13 +652,14 @@ func (u *UserStorage) follow(userName string, followingUserName string, ctx cont
 					"followingUserName": followingUserName,
 				},
 			)
+			return "followed successfully", err
 		},
 	)
 	if err != nil {
 		return "something went wrong", err
 	}
 
-	return "followed successfully", nil
+	return result.(string), nil
 }
 
 func (u *UserStorage) unfollow(userName string, followingUserName string, ctx context.Context) (string, error) {
@@ -529,8 +670,9 @@ func (u *UserStorage) unfollow(userName string, followingUserName string, ctx co
 			return tx.Run(ctx,
 				`MATCH (u:User {userName:$userName}) 
          MATCH (p:User {userName:$followingUserName})
-         MATCH (u)-[f:FOLLOWING]->(p)
-         DELETE f
+         OPTIONAL MATCH (u)-[f:FOLLOWING]->(p)
+         OPTIONAL MATCH (u)-[r:FOLLOW_REQUEST]->(p)
+         DELETE f, r
         `,
 				map[string]interface{}{
 					"userName":          userName,
@@ -560,6 +702,7 @@ func (u *UserStorage) followers(userName string, ctx context.Context) ([]followe
 			result, err := tx.Run(ctx,
 				`
         MATCH(u:User{userName:$userName})-[:FOLLOWING]->(p:User)
+        WHERE NOT (u)-[:BLOCKED]-(p)
         return p.userName AS userName, p.profilePic AS profilePic 
         `,
 				map[string]any{
@@ -620,6 +763,7 @@ func (u *UserStorage) followersByUserName(userName string, loggedInUser string,
 				`
         MATCH(u:User{userName:$userName})-[:FOLLOWING]->(p:User)
         MATCH(l:User{userName:$loggedInUser})
+        WHERE NOT (l)-[:BLOCKED]-(p)
         return p.userName AS userName, p.profilePic AS profilePic, Exists((l)-[:FOLLOWING]->(p)) AS isFollowing 
         `,
 				map[string]any{
@@ -674,6 +818,7 @@ func (u *UserStorage) followings(userName string, ctx context.Context) ([]follow
 			result, err := tx.Run(ctx,
 				`
         MATCH(u:User{userName:$userName})<-[:FOLLOWING]-(p:User)
+        WHERE NOT (u)-[:BLOCKED]-(p)
         return p.userName AS userName, p.profilePic AS profilePic 
         `,
 				map[string]any{
@@ -734,6 +879,7 @@ func (u *UserStorage) followingsByUserName(userName string, loggedInUser string,
 				`
         MATCH(u:User{userName:$userName})<-[:FOLLOWING]-(p:User)
         MATCH(l:User{userName:$loggedInUser})
+        WHERE NOT (l)-[:BLOCKED]-(p)
         return p.userName AS userName, p.profilePic AS profilePic, Exists((l)-[:FOLLOWING]->(p)) AS isFollowing 
         `,
 				map[string]any{
@@ -773,3 +919,2447 @@ func (u *UserStorage) followingsByUserName(userName string, loggedInUser string,
 
 	return arr, nil
 }
+
+type otpPurpose string
+
+const (
+	emailOtpPurpose  otpPurpose = "email"
+	mobileOtpPurpose otpPurpose = "mobile"
+)
+
+const (
+	otpTTL            = 10 * time.Minute
+	otpResendCooldown = time.Minute
+	otpMaxAttempts    = 5
+	otpLockDuration   = 15 * time.Minute
+)
+
+var (
+	errOtpInvalid  = errors.New("invalid otp")
+	errOtpExpired  = errors.New("otp expired")
+	errOtpCooldown = errors.New("please wait before requesting a new otp")
+	errOtpLocked   = errors.New("too many failed attempts, try again later")
+)
+
+// issueOtp replaces any otp the user has for purpose with a fresh one and
+// returns the plain code. Only a hash of the code is stored.
+func (u *UserStorage) issueOtp(userName string, purpose otpPurpose, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	generatedOtp := otp.EncodeToString(6)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         OPTIONAL MATCH (u)-[:HAS_OTP]->(o:Otp {purpose:$purpose})
+         RETURN o.issued_at > datetime($now) - duration({seconds:$cooldown}) AS inCooldown, o.locked_until > datetime($now) AS isLocked`,
+				map[string]interface{}{
+					"userName": userName,
+					"purpose":  string(purpose),
+					"now":      now.Format(time.RFC3339),
+					"cooldown": int64(otpResendCooldown.Seconds()),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if isLocked, _ := record.Get("isLocked"); isLocked == true {
+				return nil, errOtpLocked
+			}
+			if inCooldown, _ := record.Get("inCooldown"); inCooldown == true {
+				return nil, errOtpCooldown
+			}
+
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MERGE (u)-[:HAS_OTP]->(o:Otp {purpose:$purpose})
+         SET o.code=$code, o.attempts=0, o.issued_at=datetime($now), o.expires_at=datetime($now) + duration({seconds:$ttl})
+         REMOVE o.locked_until`,
+				map[string]interface{}{
+					"userName": userName,
+					"purpose":  string(purpose),
+					"code":     otp.Hash(generatedOtp),
+					"now":      now.Format(time.RFC3339),
+					"ttl":      int64(otpTTL.Seconds()),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return generatedOtp, nil
+}
+
+// consumeOtp checks code against the user's otp for purpose and deletes the
+// otp on success. Every failed attempt is counted and the otp is locked once
+// otpMaxAttempts is reached. The count starts over when a lock runs out.
+func (u *UserStorage) consumeOtp(userName string, purpose otpPurpose, code string, ctx context.Context) error {
+	return u.checkOtp(userName, purpose, code, true, ctx)
+}
+
+// verifyOtp is consumeOtp without deleting the otp, for flows that have more
+// to check before the code is spent.
+func (u *UserStorage) verifyOtp(userName string, purpose otpPurpose, code string, ctx context.Context) error {
+	return u.checkOtp(userName, purpose, code, false, ctx)
+}
+
+func (u *UserStorage) checkOtp(userName string, purpose otpPurpose, code string, consume bool, ctx context.Context) error {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	outcome, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			// the write lock on the otp is taken before anything is read, so
+			// parallel guesses are counted one after the other
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})-[:HAS_OTP]->(o:Otp {purpose:$purpose})
+         SET o._lock=true
+         WITH o, o.locked_until <= datetime($now) AS lockExpired
+         SET o.attempts=CASE WHEN lockExpired THEN 0 ELSE coalesce(o.attempts, 0) END, o.locked_until=CASE WHEN lockExpired THEN null ELSE o.locked_until END
+         REMOVE o._lock
+         RETURN o.code AS code, o.expires_at < datetime($now) AS isExpired, o.locked_until > datetime($now) AS isLocked`,
+				map[string]interface{}{
+					"userName": userName,
+					"purpose":  string(purpose),
+					"now":      now.Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Single(ctx)
+			if err != nil {
+				return errOtpInvalid, nil
+			}
+
+			if isLocked, _ := record.Get("isLocked"); isLocked == true {
+				return errOtpLocked, nil
+			}
+			if isExpired, _ := record.Get("isExpired"); isExpired == true {
+				return errOtpExpired, nil
+			}
+
+			hashed, _ := record.Get("code")
+			hashedCode, _ := hashed.(string)
+
+			if otp.Matches(code, hashedCode) {
+				if !consume {
+					return nil, nil
+				}
+				_, err = tx.Run(ctx,
+					"MATCH (u:User {userName:$userName})-[:HAS_OTP]->(o:Otp {purpose:$purpose}) DETACH DELETE o",
+					map[string]interface{}{
+						"userName": userName,
+						"purpose":  string(purpose),
+					},
+				)
+				return nil, err
+			}
+
+			result, err = tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})-[:HAS_OTP]->(o:Otp {purpose:$purpose})
+         SET o.attempts=o.attempts + 1
+         SET o.locked_until=CASE WHEN o.attempts >= $maxAttempts THEN datetime($now) + duration({seconds:$lock}) ELSE null END
+         RETURN o.attempts AS attempts`,
+				map[string]interface{}{
+					"userName":    userName,
+					"purpose":     string(purpose),
+					"maxAttempts": otpMaxAttempts,
+					"now":         now.Format(time.RFC3339),
+					"lock":        int64(otpLockDuration.Seconds()),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err = result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			attempts, _ := record.Get("attempts")
+			if count, _ := attempts.(int64); count >= otpMaxAttempts {
+				return errOtpLocked, nil
+			}
+			return errOtpInvalid, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	// verification failures are returned as the transaction result so the
+	// attempt counter is committed
+	if outcomeErr, ok := outcome.(error); ok {
+		return outcomeErr
+	}
+
+	return nil
+}
+
+func (u *UserStorage) resendEmailOtp(userName string, ctx context.Context) (string, error) {
+	user, err := u.getUserContact(userName, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if user.IsEmailVerified {
+		return "", errors.New("email already verified")
+	}
+
+	generatedOtp, err := u.issueOtp(userName, emailOtpPurpose, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err = u.notifier.Notify(ctx, notifier.VerifyEmailOtp, user.Email, notifier.OtpData{Name: user.FirstName, Otp: generatedOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		return "", err
+	}
+
+	return "Otp sent successfully", nil
+}
+
+func (u *UserStorage) resendMobileOtp(userName string, ctx context.Context) (string, error) {
+	user, err := u.getUserContact(userName, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Mobile == "" {
+		return "", errors.New("mobile not added")
+	}
+
+	if user.IsMobileVerified {
+		return "", errors.New("mobile already verified")
+	}
+
+	err = u.sendMobileOtp(userName, user.Mobile, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return "Otp sent successfully", nil
+}
+
+func (u *UserStorage) sendMobileOtp(userName string, mobile string, ctx context.Context) error {
+	generatedOtp, err := u.issueOtp(userName, mobileOtpPurpose, ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.notifier.Notify(ctx, notifier.VerifyMobileOtp, mobile, notifier.OtpData{Otp: generatedOtp, ExpiresIn: otpTTL})
+}
+
+func (u *UserStorage) getUserContact(userName string, ctx context.Context) (*models.User, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN u.firstName AS firstName, u.email AS email, u.mobile AS mobile, u.isEmailVerified AS isEmailVerified, u.isMobileVerified AS isMobileVerified",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+
+	return user, nil
+}
+
+const passwordResetOtpPurpose otpPurpose = "password_reset"
+
+func (u *UserStorage) forgotPassword(email string, ctx context.Context) (string, error) {
+	// the response is the same whether or not the email is registered
+	message := "If the email is registered, an otp has been sent"
+
+	user, err := u.getUserByEmail(email, ctx)
+	if err != nil {
+		return message, nil
+	}
+
+	generatedOtp, err := u.issueOtp(user.UserName, passwordResetOtpPurpose, ctx)
+	if err != nil {
+		log.Printf("failed to issue password reset otp for %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	err = u.notifier.Notify(ctx, notifier.PasswordResetOtp, email, notifier.OtpData{Name: user.FirstName, Otp: generatedOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		log.Printf("failed to send password reset otp to %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	return message, nil
+}
+
+func (u *UserStorage) resetPassword(email string, code string, password string, ctx context.Context) (string, error) {
+	// checked before looking the user up so the answer doesn't depend on
+	// whether the email is registered
+	if err := u.passwordPolicy.Check(password, email); err != nil {
+		return "", err
+	}
+
+	// an unknown email goes through the otp check with no user to match,
+	// which fails like a wrong code
+	var userName string
+	user, err := u.getUserByEmail(email, ctx)
+	if err == nil {
+		userName = user.UserName
+	}
+
+	// the username is only compared once the code is known to be valid, so
+	// the policy error can't be used to learn it
+	err = u.verifyOtp(userName, passwordResetOtpPurpose, code, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.passwordPolicy.Check(password, userName); err != nil {
+		return "", err
+	}
+
+	err = u.consumeOtp(userName, passwordResetOtpPurpose, code, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err = u.setPassword(userName, password, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return "Password reset successfully", nil
+}
+
+func (u *UserStorage) changePassword(userName string, currentPassword string, newPassword string, ctx context.Context) (*authTokens, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN u.password AS password, u.email AS email, u.isEmailVerified AS isEmailVerified, u.isMobileVerified AS isMobileVerified, u.isComplete AS isComplete",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+
+	if !hash.CheckPasswordHash(currentPassword, user.Password) {
+		return nil, errIncorrectPassword
+	}
+
+	if err := u.passwordPolicy.Check(newPassword, userName, user.Email); err != nil {
+		return nil, err
+	}
+
+	err = u.setPassword(userName, newPassword, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// every session was revoked by the change, hand the caller a fresh one
+	return u.createSession(userName, ctx)
+}
+
+// setPassword stores a new password and revokes every session of the user.
+func (u *UserStorage) setPassword(userName string, password string, ctx context.Context) error {
+	hashedPassword, err := hash.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         SET u.password=$password, u.password_changed_at=datetime($now), u.updated_at=datetime($now)
+         WITH u
+         OPTIONAL MATCH (s:Session)-[:SESSION_OF]->(u)
+         WHERE s.revoked_at IS NULL
+         SET s.revoked_at=datetime($now)`,
+				map[string]interface{}{
+					"userName": userName,
+					"password": hashedPassword,
+					"now":      now.Format(time.RFC3339),
+				},
+			)
+		},
+	)
+
+	return err
+}
+
+func (u *UserStorage) getUserByEmail(email string, ctx context.Context) (*models.User, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {email:$email}) RETURN u.userName AS userName, u.firstName AS firstName, u.email AS email, u.isEmailVerified AS isEmailVerified",
+				map[string]interface{}{
+					"email": email,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+
+	return user, nil
+}
+
+const sessionTTL = 30 * 24 * time.Hour
+
+var errSessionInvalid = errors.New("invalid session")
+
+// authTokens holds either the tokens of a new session or, when the user
+// still has to pass the second factor, only MfaToken.
+type authTokens struct {
+	AccessToken  string
+	RefreshToken string
+	MfaToken     string
+}
+
+// createSession starts a new session for the user and returns its access
+// and refresh tokens.
+func (u *UserStorage) createSession(userName string, ctx context.Context) (*authTokens, error) {
+	refreshToken, err := jwtclaim.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	sessionId := uuid.New().String()
+
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         CREATE (s:Session {uuid:$sessionId, refresh_token:$refreshToken, created_at:datetime($now), last_used_at:datetime($now), expires_at:datetime($now) + duration({seconds:$ttl})})
+         CREATE (s)-[:SESSION_OF]->(u)`,
+				map[string]interface{}{
+					"userName":     userName,
+					"sessionId":    sessionId,
+					"refreshToken": jwtclaim.HashRefreshToken(refreshToken),
+					"now":          now.Format(time.RFC3339),
+					"ttl":          int64(sessionTTL.Seconds()),
+				},
+			)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := u.accessToken(userName, sessionId, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// refreshSession rotates the refresh token of a session and issues a new
+// access token. Presenting an already rotated refresh token revokes the
+// session, since it means the token was copied.
+func (u *UserStorage) refreshSession(refreshToken string, ctx context.Context) (*authTokens, error) {
+	newRefreshToken, err := jwtclaim.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	hashed := jwtclaim.HashRefreshToken(refreshToken)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (s:Session)-[:SESSION_OF]->(u:User)
+         WHERE s.refresh_token=$refreshToken OR s.previous_refresh_token=$refreshToken
+         RETURN s.uuid AS sessionId, u.userName AS userName, coalesce(u.isEmailVerified, false) AS isEmailVerified, coalesce(u.isMobileVerified, false) AS isMobileVerified, coalesce(u.isComplete, false) AS isComplete, coalesce(u.role, $defaultRole) AS role, s.refresh_token=$refreshToken AS isCurrent, s.revoked_at IS NULL AND s.expires_at > datetime($now) AS isActive`,
+				map[string]interface{}{
+					"refreshToken": hashed,
+					"defaultRole":  string(jwtclaim.RoleUser),
+					"now":          now.Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Single(ctx)
+			if err != nil {
+				return errSessionInvalid, nil
+			}
+
+			sessionId, _ := record.Get("sessionId")
+			userName, _ := record.Get("userName")
+			isEmailVerified, _ := record.Get("isEmailVerified")
+			isMobileVerified, _ := record.Get("isMobileVerified")
+			isComplete, _ := record.Get("isComplete")
+			role, _ := record.Get("role")
+			isCurrent, _ := record.Get("isCurrent")
+			isActive, _ := record.Get("isActive")
+
+			if isActive != true {
+				return errSessionInvalid, nil
+			}
+
+			if isCurrent != true {
+				_, err = tx.Run(ctx,
+					"MATCH (s:Session {uuid:$sessionId}) SET s.revoked_at=datetime($now)",
+					map[string]interface{}{
+						"sessionId": sessionId,
+						"now":       now.Format(time.RFC3339),
+					},
+				)
+				if err != nil {
+					return nil, err
+				}
+				return errSessionInvalid, nil
+			}
+
+			_, err = tx.Run(ctx,
+				`MATCH (s:Session {uuid:$sessionId})
+         SET s.previous_refresh_token=s.refresh_token, s.refresh_token=$newRefreshToken, s.last_used_at=datetime($now), s.expires_at=datetime($now) + duration({seconds:$ttl})`,
+				map[string]interface{}{
+					"sessionId":       sessionId,
+					"newRefreshToken": jwtclaim.HashRefreshToken(newRefreshToken),
+					"now":             now.Format(time.RFC3339),
+					"ttl":             int64(sessionTTL.Seconds()),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			state := jwtclaim.StateFor(isEmailVerified.(bool), isMobileVerified.(bool), isComplete.(bool))
+			return jwtclaim.CreateJwtToken(userName.(string), sessionId.(string), state, jwtclaim.Role(role.(string)))
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// a reused token revokes the session, so the error is returned as the
+	// transaction result to get it committed
+	if resultErr, ok := result.(error); ok {
+		return nil, resultErr
+	}
+
+	return &authTokens{
+		AccessToken:  result.(string),
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+func (u *UserStorage) revokeSession(userName string, sessionId string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (s:Session {uuid:$sessionId})-[:SESSION_OF]->(:User {userName:$userName})
+         SET s.revoked_at=coalesce(s.revoked_at, datetime($now))`,
+				map[string]interface{}{
+					"userName":  userName,
+					"sessionId": sessionId,
+					"now":       time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "logged out successfully", nil
+}
+
+func (u *UserStorage) revokeAllSessions(userName string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (s:Session)-[:SESSION_OF]->(:User {userName:$userName})
+         WHERE s.revoked_at IS NULL
+         SET s.revoked_at=datetime($now)`,
+				map[string]interface{}{
+					"userName": userName,
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "logged out from all devices", nil
+}
+
+// accessToken issues an access token for an existing session with the
+// current state and role of the user.
+func (u *UserStorage) accessToken(userName string, sessionId string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN coalesce(u.isEmailVerified, false) AS isEmailVerified, coalesce(u.isMobileVerified, false) AS isMobileVerified, coalesce(u.isComplete, false) AS isComplete, coalesce(u.role, $defaultRole) AS role",
+				map[string]interface{}{
+					"userName":    userName,
+					"defaultRole": string(jwtclaim.RoleUser),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return "", errors.New("not able to convert")
+	}
+
+	state := jwtclaim.StateFor(user.IsEmailVerified, user.IsMobileVerified, user.IsComplete)
+	return jwtclaim.CreateJwtToken(userName, sessionId, state, jwtclaim.Role(user.Role))
+}
+
+func (u *UserStorage) updateRole(userName string, role jwtclaim.Role, ctx context.Context) (string, error) {
+	isUserNameExist := u.userNameExists(userName, ctx)
+
+	if !isUserNameExist {
+		return "", errors.New("user does not exists")
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) SET u.role=$role, u.updated_at=datetime($now)",
+				map[string]interface{}{
+					"userName": userName,
+					"role":     string(role),
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "role updated successfully", nil
+}
+
+var errProviderEmailNotVerified = errors.New("email is not verified by the identity provider")
+
+// missingFieldsError is returned when a new account can't be created from
+// the identity alone and the client has to ask the user for more details.
+type missingFieldsError struct {
+	fields []string
+}
+
+func (e *missingFieldsError) Error() string {
+	return "missing fields"
+}
+
+// oidcLogin signs in the user linked to identity. Unlinked identities are
+// linked to the account with the same email, ignoring case, or a new account
+// is created which then goes through the regular onboarding. An account
+// whose email was never verified loses its password, mobile, two-factor
+// setup and sessions when it is linked.
+func (u *UserStorage) oidcLogin(identity *oidc.Identity, userName string, firstName string, lastName string, ctx context.Context) (*authTokens, bool, error) {
+	linkedUserName, err := u.userNameByIdentity(identity, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if linkedUserName != "" {
+		tokens, err := u.startSession(linkedUserName, ctx)
+		return tokens, false, err
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return nil, false, errProviderEmailNotVerified
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	email := strings.ToLower(identity.Email)
+	existing, err := u.getUserByEmailFold(email, ctx)
+	if err == nil {
+		_, err = session.ExecuteWrite(ctx,
+			func(tx neo4j.ManagedTransaction) (any, error) {
+				if !existing.IsEmailVerified {
+					// anyone can sign up with an address they don't own, so an
+					// unverified account is handed over without the credentials
+					// and sessions of whoever created it
+					_, err := tx.Run(ctx,
+						`MATCH (u:User {userName:$userName})
+             REMOVE u.password, u.mobile, u.totp_secret, u.totp_pending_secret, u.totp_last_step, u.totp_backup_codes, u.totp_attempts, u.totp_locked_until
+             SET u.isMobileVerified=false, u.totp_enabled=false
+             WITH u
+             OPTIONAL MATCH (u)-[:HAS_OTP]->(o:Otp)
+             DETACH DELETE o
+             WITH DISTINCT u
+             OPTIONAL MATCH (s:Session)-[:SESSION_OF]->(u)
+             WHERE s.revoked_at IS NULL
+             SET s.revoked_at=datetime($now)`,
+						map[string]interface{}{
+							"userName": existing.UserName,
+							"now":      now.Format(time.RFC3339),
+						},
+					)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				return tx.Run(ctx,
+					`MATCH (u:User {userName:$userName})
+           MERGE (i:Identity {provider:$provider, subject:$subject})
+           ON CREATE SET i.uuid=randomUUID(), i.created_at=datetime($now)
+           MERGE (i)-[:IDENTITY_OF]->(u)
+           SET u.isEmailVerified=true, u.updated_at=datetime($now)`,
+					map[string]interface{}{
+						"userName": existing.UserName,
+						"provider": identity.Provider,
+						"subject":  identity.Subject,
+						"now":      now.Format(time.RFC3339),
+					},
+				)
+			})
+		if err != nil {
+			return nil, false, err
+		}
+
+		tokens, err := u.startSession(existing.UserName, ctx)
+		return tokens, false, err
+	}
+
+	if firstName == "" {
+		firstName = identity.FirstName
+	}
+	if lastName == "" {
+		lastName = identity.LastName
+	}
+
+	var missing []string
+	if userName == "" {
+		missing = append(missing, "userName")
+	}
+	if firstName == "" {
+		missing = append(missing, "firstName")
+	}
+	if lastName == "" {
+		missing = append(missing, "lastName")
+	}
+	if len(missing) > 0 {
+		return nil, false, &missingFieldsError{fields: missing}
+	}
+
+	if u.userNameExists(userName, ctx) || u.userNameReserved(userName, ctx) {
+		return nil, false, errUserNameTaken
+	}
+
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`CREATE (u:User {firstName:$firstName, lastName:$lastName, userName:$userName, email:$email, isEmailVerified:true, isMobileVerified:false, isComplete:false, role:$role, created_at:datetime($now), updated_at:datetime($now)})
+         CREATE (i:Identity {provider:$provider, subject:$subject, uuid:randomUUID(), created_at:datetime($now)})
+         CREATE (i)-[:IDENTITY_OF]->(u)`,
+				map[string]interface{}{
+					"firstName": firstName,
+					"lastName":  lastName,
+					"userName":  userName,
+					"email":     email,
+					"role":      string(jwtclaim.RoleUser),
+					"provider":  identity.Provider,
+					"subject":   identity.Subject,
+					"now":       now.Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return nil, false, err
+	}
+
+	tokens, err := u.createSession(userName, ctx)
+	return tokens, true, err
+}
+
+// getUserByEmailFold looks up a user by a lower cased email, ignoring the
+// case the email was stored with. A verified account wins when several
+// accounts only differ in case.
+func (u *UserStorage) getUserByEmailFold(email string, ctx context.Context) (*models.User, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User) WHERE toLower(u.email) = $email
+         RETURN u.userName AS userName, u.firstName AS firstName, u.email AS email, coalesce(u.isEmailVerified, false) AS isEmailVerified
+         ORDER BY isEmailVerified DESC LIMIT 1`,
+				map[string]interface{}{
+					"email": email,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+
+	return user, nil
+}
+
+func (u *UserStorage) userNameByIdentity(identity *oidc.Identity, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (:Identity {provider:$provider, subject:$subject})-[:IDENTITY_OF]->(u:User) RETURN u.userName AS userName",
+				map[string]interface{}{
+					"provider": identity.Provider,
+					"subject":  identity.Subject,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			records, err := result.Collect(ctx)
+			if err != nil || len(records) == 0 {
+				return "", err
+			}
+			userName, _ := records[0].Get("userName")
+			return userName, nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	userName, _ := result.(string)
+	return userName, nil
+}
+
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+type exportProfile struct {
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	UserName   string `json:"userName"`
+	Email      string `json:"email"`
+	Mobile     string `json:"mobile"`
+	Bio        string `json:"bio"`
+	ProfilePic string `json:"profilePic"`
+	Created_at string `json:"created_at"`
+}
+
+type exportLink struct {
+	Id    string `json:"id"`
+	Url   string `json:"url"`
+	Image string `json:"image"`
+}
+
+type exportImage struct {
+	Key      string `json:"key"`
+	Position int    `json:"position"`
+}
+
+type exportStyle struct {
+	Id         string        `json:"id"`
+	Image      string        `json:"image"`
+	Images     []exportImage `json:"images"`
+	Links      []exportLink  `json:"links"`
+	Hashtags   []string      `json:"hashtags"`
+	Tags       []string      `json:"tags"`
+	Created_at string        `json:"created_at"`
+}
+
+type exportCollection struct {
+	Name       string   `json:"name"`
+	IsPrivate  bool     `json:"isPrivate"`
+	Styles     []string `json:"styles"`
+	Created_at string   `json:"created_at"`
+}
+
+type exportComment struct {
+	Id         string `json:"id"`
+	StyleId    string `json:"styleId"`
+	ParentId   string `json:"parentId"`
+	Text       string `json:"text"`
+	Created_at string `json:"created_at"`
+}
+
+type userExport struct {
+	Profile     exportProfile      `json:"profile"`
+	Styles      []exportStyle      `json:"styles"`
+	FavTags     []string           `json:"favTags"`
+	Followers   []string           `json:"followers"`
+	Followings  []string           `json:"followings"`
+	Trends      []string           `json:"trends"`
+	Collections []exportCollection `json:"collections"`
+	Comments    []exportComment    `json:"comments"`
+	ExportedAt  string             `json:"exportedAt"`
+}
+
+// exportData collects everything stored about the user once they proved
+// they still hold the account.
+func (u *UserStorage) exportData(userName string, password string, code string, ctx context.Context) (*userExport, error) {
+	if err := u.reauthenticate(userName, password, code, ctx); err != nil {
+		return nil, err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         RETURN {firstName:u.firstName, lastName:u.lastName, userName:u.userName, email:u.email, mobile:u.mobile, bio:u.bio, profilePic:u.profilePic, created_at:toString(u.created_at)} AS profile,
+         [(s:Style)-[:CREATED_BY]->(u) | {id:s.uuid, image:s.image, images:[(s)-[:HAS_MEDIA]->(m:Media) | {key:m.key, position:m.position}], created_at:toString(s.created_at), links:[(s)-[:LINKED_TO]->(l:Link) | {id:l.uuid, url:l.url, image:l.image}], hashtags:[(s)-[:HASHTAG_TO]->(h:Hashtag) | h.title], tags:[(s)-[:TAG_TO]->(t:Tag) | t.name]}] AS styles,
+         [(u)-[:MARK_FAV]->(t:Tag) | t.name] AS favTags,
+         [(p:User)-[:FOLLOWING]->(u) | p.userName] AS followers,
+         [(u)-[:FOLLOWING]->(p:User) | p.userName] AS followings,
+         [(u)-[:MARKED_TREND]->(s:Style) | s.uuid] AS trends,
+         [(c:Collection)-[:OWNED_BY]->(u) | {name:c.name, isPrivate:c.isPrivate, created_at:toString(c.created_at), styles:[(s:Style)-[:SAVED_IN]->(c) | s.uuid]}] AS collections,
+         [(cm:Comment)-[:COMMENTED_BY]->(u) | {id:cm.uuid, styleId:head([(cm)-[:COMMENT_ON]->(s:Style) | s.uuid]), parentId:head([(cm)-[:REPLY_TO]->(parent:Comment) | parent.uuid]), text:cm.text, created_at:toString(cm.created_at)}] AS comments`,
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var data userExport
+			json.Unmarshal(jsonData, &data)
+
+			return &data, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := result.(*userExport)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+	data.ExportedAt = time.Now().Format(time.RFC3339)
+
+	return data, nil
+}
+
+// requestDeletion schedules the account for deletion once the grace period
+// is over, after the user proved they still hold the account. Until then
+// the user can log in and cancel it.
+func (u *UserStorage) requestDeletion(userName string, password string, code string, ctx context.Context) (time.Time, error) {
+	if err := u.reauthenticate(userName, password, code, ctx); err != nil {
+		return time.Time{}, err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	deleteAfter := now.Add(accountDeletionGracePeriod)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) SET u.deletion_requested_at=datetime($now), u.delete_after=datetime($deleteAfter)",
+				map[string]interface{}{
+					"userName":    userName,
+					"now":         now.Format(time.RFC3339),
+					"deleteAfter": deleteAfter.Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return deleteAfter, nil
+}
+
+func (u *UserStorage) cancelDeletion(userName string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) REMOVE u.deletion_requested_at, u.delete_after",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "account deletion cancelled", nil
+}
+
+// purgeDeletedAccounts removes accounts whose grace period is over together
+// with their styles and everything attached to the account. The storage
+// keys of the removed images and of unused uploads are queued as
+// BlobDeletion nodes. Links and hashtags other styles still point to are
+// kept. Each kind of node is collected in its own subquery so an active
+// account doesn't multiply them into one huge row set.
+func (u *UserStorage) purgeDeletedAccounts(ctx context.Context) (int, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User)
+         WHERE u.delete_after < datetime($now)
+         WITH u LIMIT 50
+         CALL {
+           WITH u
+           OPTIONAL MATCH (s:Style)-[:CREATED_BY]->(u)
+           RETURN collect(s) AS styles
+         }
+         CALL {
+           WITH styles
+           UNWIND styles AS s
+           OPTIONAL MATCH (s)<-[:COMMENT_ON]-(c:Comment)
+           RETURN collect(DISTINCT c) AS comments
+         }
+         CALL {
+           WITH styles
+           UNWIND styles AS s
+           OPTIONAL MATCH (s)-[:HAS_MEDIA]->(m:Media)
+           RETURN collect(DISTINCT m) AS media
+         }
+         CALL {
+           WITH styles
+           UNWIND styles AS s
+           OPTIONAL MATCH (s)-[:LINKED_TO|HASHTAG_TO]->(n)
+           RETURN collect(DISTINCT n) AS attached
+         }
+         WITH u, styles, comments, media, attached, reduce(keys = [], key IN [x IN styles | x.image] + [x IN media | x.key] + [u.profilePic] | CASE WHEN key IS NULL OR key = "" OR key IN keys THEN keys ELSE keys + key END) AS keys
+         FOREACH (key IN keys | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+         FOREACH (n IN comments + media + styles | DETACH DELETE n)
+         WITH u, attached
+         CALL {
+           WITH attached
+           UNWIND attached AS n
+           WITH n WHERE NOT (n)<-[:LINKED_TO|HASHTAG_TO]-(:Style)
+           OPTIONAL MATCH (n)-[:HAS_MEDIA]->(nm:Media)
+           WITH collect(DISTINCT n) AS orphans, collect(DISTINCT nm) AS orphanMedia
+           FOREACH (key IN reduce(keys = [], key IN [x IN orphans | x.image] + [x IN orphanMedia | x.key] | CASE WHEN key IS NULL OR key = "" OR key IN keys THEN keys ELSE keys + key END) | CREATE (:BlobDeletion {key:key, requested_at:datetime($now)}))
+           FOREACH (n IN orphans + orphanMedia | DETACH DELETE n)
+           RETURN count(*) AS orphansRemoved
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (up:Upload)-[:UPLOADED_BY]->(u)
+           RETURN collect(up) AS uploads
+         }
+         FOREACH (up IN uploads | CREATE (:BlobDeletion {key:up.key, upload_id:up.upload_id, requested_at:datetime($now)}))
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)-[:HAS_MEDIA]->(n:Media)
+           RETURN collect(n) AS profileMedia
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)<-[:SESSION_OF]-(n:Session)
+           RETURN collect(n) AS sessions
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)-[:HAS_OTP]->(n:Otp)
+           RETURN collect(n) AS otps
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)<-[:IDENTITY_OF]-(n:Identity)
+           RETURN collect(n) AS identities
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)-[:HAD_USERNAME]->(n:UserNameHistory)
+           RETURN collect(n) AS userNames
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)<-[:OWNED_BY]-(n:Collection)
+           RETURN collect(n) AS collections
+         }
+         CALL {
+           WITH u
+           OPTIONAL MATCH (u)<-[:COMMENTED_BY]-(n:Comment)
+           RETURN collect(n) AS userComments
+         }
+         CALL {
+           WITH userComments
+           UNWIND userComments AS c
+           OPTIONAL MATCH (c)<-[:REPLY_TO]-(n:Comment)
+           RETURN collect(DISTINCT n) AS replies
+         }
+         FOREACH (n IN uploads + profileMedia + sessions + otps + identities + userNames + collections + replies + userComments | DETACH DELETE n)
+         DETACH DELETE u
+         RETURN count(*) AS purged`,
+				map[string]interface{}{
+					"now": now.Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			purged, _ := record.Get("purged")
+			return purged, nil
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	purged, _ := result.(int64)
+	return int(purged), nil
+}
+
+const (
+	totpIssuer      = "IStyle"
+	backupCodeCount = 10
+)
+
+var (
+	errTotpEnabled    = errors.New("two-factor authentication already enabled")
+	errTotpNotEnabled = errors.New("two-factor authentication not enabled")
+)
+
+// startSession creates a session right away unless the user has two-factor
+// authentication enabled. In that case only an mfa token is returned, which
+// completeMfaLogin exchanges for a session.
+func (u *UserStorage) startSession(userName string, ctx context.Context) (*authTokens, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN coalesce(u.totp_enabled, false) AS totpEnabled",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			totpEnabled, _ := record.Get("totpEnabled")
+			return totpEnabled, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if totpEnabled, _ := result.(bool); !totpEnabled {
+		return u.createSession(userName, ctx)
+	}
+
+	mfaToken, err := jwtclaim.CreateMfaToken(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authTokens{MfaToken: mfaToken}, nil
+}
+
+func (u *UserStorage) completeMfaLogin(mfaToken string, code string, ctx context.Context) (*authTokens, error) {
+	userName, err := jwtclaim.ParseMfaToken(mfaToken)
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+
+	if err := u.verifySecondFactor(userName, code, ctx); err != nil {
+		return nil, err
+	}
+
+	return u.createSession(userName, ctx)
+}
+
+// setupTotp stores a new pending secret for the user. It only becomes active
+// once confirmTotp has seen a valid code for it.
+func (u *UserStorage) setupTotp(userName string, ctx context.Context) (string, string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         WHERE NOT coalesce(u.totp_enabled, false)
+         SET u.totp_pending_secret=$secret
+         RETURN u.email AS email`,
+				map[string]interface{}{
+					"userName": userName,
+					"secret":   secret,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, errTotpEnabled
+			}
+			email, _ := record.Get("email")
+			return email, nil
+		})
+	if err != nil {
+		return "", "", err
+	}
+
+	account, _ := result.(string)
+	if account == "" {
+		account = userName
+	}
+
+	return secret, totp.URI(totpIssuer, account, secret), nil
+}
+
+// confirmTotp enables two-factor authentication once the user proves the
+// pending secret is set up in their app, and returns fresh backup codes.
+func (u *UserStorage) confirmTotp(userName string, code string, ctx context.Context) ([]string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	codes, hashedCodes := newBackupCodes()
+
+	now := time.Now()
+	outcome, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := lockSecondFactor(tx, userName, now, ctx)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if totpEnabled, _ := record.Get("totpEnabled"); totpEnabled == true {
+				return errTotpEnabled, nil
+			}
+			pending, _ := record.Get("pendingSecret")
+			secret, _ := pending.(string)
+			if secret == "" {
+				return errTotpNotEnabled, nil
+			}
+			if isLocked, _ := record.Get("isLocked"); isLocked == true {
+				return errOtpLocked, nil
+			}
+
+			step, ok := totp.Validate(code, secret, now)
+			if !ok {
+				return secondFactorFailed(tx, userName, now, ctx)
+			}
+
+			_, err = tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         SET u.totp_secret=u.totp_pending_secret, u.totp_enabled=true, u.totp_last_step=$step, u.totp_backup_codes=$backupCodes, u.totp_attempts=0
+         REMOVE u.totp_pending_secret, u.totp_locked_until`,
+				map[string]interface{}{
+					"userName":    userName,
+					"step":        step,
+					"backupCodes": hashedCodes,
+				},
+			)
+			return nil, err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if outcomeErr, ok := outcome.(error); ok {
+		return nil, outcomeErr
+	}
+
+	return codes, nil
+}
+
+func (u *UserStorage) disableTotp(userName string, code string, ctx context.Context) (string, error) {
+	if err := u.verifySecondFactor(userName, code, ctx); err != nil {
+		return "", err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         SET u.totp_enabled=false
+         REMOVE u.totp_secret, u.totp_pending_secret, u.totp_last_step, u.totp_backup_codes, u.totp_attempts, u.totp_locked_until`,
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "two-factor authentication disabled", nil
+}
+
+func (u *UserStorage) regenerateBackupCodes(userName string, code string, ctx context.Context) ([]string, error) {
+	if err := u.verifySecondFactor(userName, code, ctx); err != nil {
+		return nil, err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	codes, hashedCodes := newBackupCodes()
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) SET u.totp_backup_codes=$backupCodes",
+				map[string]interface{}{
+					"userName":    userName,
+					"backupCodes": hashedCodes,
+				},
+			)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code that has not been
+// used yet or one of the user's backup codes, which is then spent. Failures
+// are counted and lock the second factor like otps do.
+func (u *UserStorage) verifySecondFactor(userName string, code string, ctx context.Context) error {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	outcome, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := lockSecondFactor(tx, userName, now, ctx)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return errOtpInvalid, nil
+			}
+
+			if totpEnabled, _ := record.Get("totpEnabled"); totpEnabled != true {
+				return errTotpNotEnabled, nil
+			}
+			if isLocked, _ := record.Get("isLocked"); isLocked == true {
+				return errOtpLocked, nil
+			}
+
+			secretValue, _ := record.Get("secret")
+			secret, _ := secretValue.(string)
+			lastStepValue, _ := record.Get("lastStep")
+			lastStep, _ := lastStepValue.(int64)
+
+			if step, ok := totp.Validate(code, secret, now); ok && step > lastStep {
+				_, err = tx.Run(ctx,
+					"MATCH (u:User {userName:$userName}) SET u.totp_last_step=$step, u.totp_attempts=0",
+					map[string]interface{}{
+						"userName": userName,
+						"step":     step,
+					},
+				)
+				return nil, err
+			}
+
+			backupCodes, _ := record.Get("backupCodes")
+			hashedCodes, _ := backupCodes.([]interface{})
+			for _, hashed := range hashedCodes {
+				hashedCode, _ := hashed.(string)
+				if otp.Matches(code, hashedCode) {
+					_, err = tx.Run(ctx,
+						"MATCH (u:User {userName:$userName}) SET u.totp_backup_codes=[c IN u.totp_backup_codes WHERE c <> $code], u.totp_attempts=0",
+						map[string]interface{}{
+							"userName": userName,
+							"code":     hashedCode,
+						},
+					)
+					return nil, err
+				}
+			}
+
+			return secondFactorFailed(tx, userName, now, ctx)
+		})
+	if err != nil {
+		return err
+	}
+
+	if outcomeErr, ok := outcome.(error); ok {
+		return outcomeErr
+	}
+
+	return nil
+}
+
+// lockSecondFactor takes the write lock on the user before the second
+// factor is read, so parallel guesses are counted one after the other and a
+// code can't be used twice. A lock that ran out starts the count over.
+func lockSecondFactor(tx neo4j.ManagedTransaction, userName string, now time.Time, ctx context.Context) (neo4j.ResultWithContext, error) {
+	return tx.Run(ctx,
+		`MATCH (u:User {userName:$userName})
+     SET u._totp_lock=true
+     WITH u, u.totp_locked_until <= datetime($now) AS lockExpired
+     SET u.totp_attempts=CASE WHEN lockExpired THEN 0 ELSE coalesce(u.totp_attempts, 0) END, u.totp_locked_until=CASE WHEN lockExpired THEN null ELSE u.totp_locked_until END
+     REMOVE u._totp_lock
+     RETURN coalesce(u.totp_enabled, false) AS totpEnabled, u.totp_secret AS secret, u.totp_pending_secret AS pendingSecret, u.totp_last_step AS lastStep,
+     coalesce(u.totp_backup_codes, []) AS backupCodes, u.totp_locked_until > datetime($now) AS isLocked`,
+		map[string]interface{}{
+			"userName": userName,
+			"now":      now.Format(time.RFC3339),
+		},
+	)
+}
+
+// secondFactorFailed counts a wrong second factor code and locks the second
+// factor once otpMaxAttempts is reached. The returned error is meant to be
+// the transaction result so the count is committed.
+func secondFactorFailed(tx neo4j.ManagedTransaction, userName string, now time.Time, ctx context.Context) (any, error) {
+	result, err := tx.Run(ctx,
+		`MATCH (u:User {userName:$userName})
+     SET u.totp_attempts=coalesce(u.totp_attempts, 0) + 1
+     SET u.totp_locked_until=CASE WHEN u.totp_attempts >= $maxAttempts THEN datetime($now) + duration({seconds:$lock}) ELSE null END
+     RETURN u.totp_attempts AS attempts`,
+		map[string]interface{}{
+			"userName":    userName,
+			"maxAttempts": otpMaxAttempts,
+			"now":         now.Format(time.RFC3339),
+			"lock":        int64(otpLockDuration.Seconds()),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, _ := record.Get("attempts")
+	if count, _ := attempts.(int64); count >= otpMaxAttempts {
+		return errOtpLocked, nil
+	}
+	return errOtpInvalid, nil
+}
+
+// newBackupCodes returns plain backup codes for the user together with the
+// hashes that are stored.
+func newBackupCodes() ([]string, []string) {
+	codes := make([]string, backupCodeCount)
+	hashedCodes := make([]string, backupCodeCount)
+	for i := range codes {
+		codes[i] = otp.EncodeToString(10)
+		hashedCodes[i] = otp.Hash(codes[i])
+	}
+	return codes, hashedCodes
+}
+
+var errFollowRequestNotFound = errors.New("follow request not found")
+
+type followRequest struct {
+	UserName   string `json:"userName"`
+	ProfilePic string `json:"profilePic"`
+	Created_at string `json:"created_at"`
+}
+
+func (u *UserStorage) followRequests(userName string, ctx context.Context) ([]followRequest, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	users, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`
+        MATCH(u:User{userName:$userName})<-[r:FOLLOW_REQUEST]-(p:User)
+        RETURN p.userName AS userName, p.profilePic AS profilePic, toString(r.created_at) AS created_at
+        ORDER BY r.created_at DESC
+        `,
+				map[string]any{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []followRequest
+
+	for _, user := range users.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(user.AsMap())
+
+		var structData followRequest
+		json.Unmarshal(jsonData, &structData)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
+
+// approveFollowRequest turns the pending request of requester into a
+// FOLLOWING relationship.
+func (u *UserStorage) approveFollowRequest(userName string, requester string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (p:User {userName:$requester})-[r:FOLLOW_REQUEST]->(u:User {userName:$userName})
+         DELETE r
+         MERGE (p)-[:FOLLOWING]->(u)
+         RETURN p.userName AS userName`,
+				map[string]interface{}{
+					"userName":  userName,
+					"requester": requester,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	if records, _ := result.([]*neo4j.Record); len(records) == 0 {
+		return "", errFollowRequestNotFound
+	}
+
+	return "follow request approved", nil
+}
+
+func (u *UserStorage) denyFollowRequest(userName string, requester string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (p:User {userName:$requester})-[r:FOLLOW_REQUEST]->(u:User {userName:$userName})
+         DELETE r
+         RETURN p.userName AS userName`,
+				map[string]interface{}{
+					"userName":  userName,
+					"requester": requester,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	if records, _ := result.([]*neo4j.Record); len(records) == 0 {
+		return "", errFollowRequestNotFound
+	}
+
+	return "follow request denied", nil
+}
+
+// updatePrivacy switches the account between private and public. Pending
+// follow requests are approved when the account becomes public.
+func (u *UserStorage) updatePrivacy(userName string, isPrivate bool, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			_, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) SET u.isPrivate=$isPrivate, u.updated_at=datetime($now)",
+				map[string]interface{}{
+					"userName":  userName,
+					"isPrivate": isPrivate,
+					"now":       time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil || isPrivate {
+				return nil, err
+			}
+
+			return tx.Run(ctx,
+				`MATCH (p:User)-[r:FOLLOW_REQUEST]->(u:User {userName:$userName})
+         DELETE r
+         MERGE (p)-[:FOLLOWING]->(u)`,
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	if isPrivate {
+		return "account is now private", nil
+	}
+	return "account is now public", nil
+}
+
+// block removes the follow relationships and requests between the two users
+// in both directions. Blocked users no longer see each other anywhere.
+func (u *UserStorage) block(userName string, blockedUserName string, ctx context.Context) (string, error) {
+	if userName == blockedUserName {
+		return "", errors.New("you cannot block yourself")
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MATCH (p:User {userName:$blockedUserName})
+         MERGE (u)-[b:BLOCKED]->(p)
+         ON CREATE SET b.created_at=datetime($now)
+         WITH u, p
+         OPTIONAL MATCH (u)-[f:FOLLOWING|FOLLOW_REQUEST]-(p)
+         DELETE f
+         RETURN DISTINCT p.userName AS userName`,
+				map[string]interface{}{
+					"userName":        userName,
+					"blockedUserName": blockedUserName,
+					"now":             time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	if records, _ := result.([]*neo4j.Record); len(records) == 0 {
+		return "", errors.New("user does not exists")
+	}
+
+	return "blocked successfully", nil
+}
+
+func (u *UserStorage) unblock(userName string, blockedUserName string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName})-[b:BLOCKED]->(p:User {userName:$blockedUserName}) DELETE b",
+				map[string]interface{}{
+					"userName":        userName,
+					"blockedUserName": blockedUserName,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "unblocked successfully", nil
+}
+
+// mute hides the styles of mutedUserName from the feed and explore of the
+// user. Unlike a block the muted user is not told and can still follow.
+func (u *UserStorage) mute(userName string, mutedUserName string, ctx context.Context) (string, error) {
+	if userName == mutedUserName {
+		return "", errors.New("you cannot mute yourself")
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         MATCH (p:User {userName:$mutedUserName})
+         MERGE (u)-[m:MUTED]->(p)
+         ON CREATE SET m.created_at=datetime($now)
+         RETURN p.userName AS userName`,
+				map[string]interface{}{
+					"userName":      userName,
+					"mutedUserName": mutedUserName,
+					"now":           time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			return result.Collect(ctx)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	if records, _ := result.([]*neo4j.Record); len(records) == 0 {
+		return "", errors.New("user does not exists")
+	}
+
+	return "muted successfully", nil
+}
+
+func (u *UserStorage) unmute(userName string, mutedUserName string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName})-[m:MUTED]->(p:User {userName:$mutedUserName}) DELETE m",
+				map[string]interface{}{
+					"userName":      userName,
+					"mutedUserName": mutedUserName,
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "unmuted successfully", nil
+}
+
+type restrictedUser struct {
+	UserName   string `json:"userName"`
+	ProfilePic string `json:"profilePic"`
+}
+
+func (u *UserStorage) blockedUsers(userName string, ctx context.Context) ([]restrictedUser, error) {
+	return u.restrictedUsers(
+		"MATCH(u:User{userName:$userName})-[r:BLOCKED]->(p:User) RETURN p.userName AS userName, p.profilePic AS profilePic ORDER BY r.created_at DESC",
+		userName, ctx)
+}
+
+func (u *UserStorage) mutedUsers(userName string, ctx context.Context) ([]restrictedUser, error) {
+	return u.restrictedUsers(
+		"MATCH(u:User{userName:$userName})-[r:MUTED]->(p:User) RETURN p.userName AS userName, p.profilePic AS profilePic ORDER BY r.created_at DESC",
+		userName, ctx)
+}
+
+func (u *UserStorage) restrictedUsers(query string, userName string, ctx context.Context) ([]restrictedUser, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	users, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx, query,
+				map[string]any{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			record, err := result.Collect(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []restrictedUser
+
+	for _, user := range users.([]*neo4j.Record) {
+		jsonData, _ := json.Marshal(user.AsMap())
+
+		var structData restrictedUser
+		json.Unmarshal(jsonData, &structData)
+
+		arr = append(arr, structData)
+	}
+
+	return arr, nil
+}
+
+const (
+	loginOtpPurpose  otpPurpose = "login"
+	loginLinkPurpose otpPurpose = "login_link"
+)
+
+// requestLoginOtp texts a login code to a verified mobile number.
+func (u *UserStorage) requestLoginOtp(mobile string, ctx context.Context) (string, error) {
+	// the response is the same whether or not the number is registered
+	message := "If the number is registered, an otp has been sent"
+
+	user, err := u.getUserByMobile(mobile, ctx)
+	if err != nil {
+		return message, nil
+	}
+
+	generatedOtp, err := u.issueOtp(user.UserName, loginOtpPurpose, ctx)
+	if err != nil {
+		log.Printf("failed to issue login otp for %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	err = u.notifier.Notify(ctx, notifier.LoginOtp, mobile, notifier.OtpData{Otp: generatedOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		log.Printf("failed to send login otp to %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	return message, nil
+}
+
+func (u *UserStorage) loginWithOtp(mobile string, code string, ctx context.Context) (*authTokens, error) {
+	user, err := u.getUserByMobile(mobile, ctx)
+	if err != nil {
+		return nil, errOtpInvalid
+	}
+
+	err = u.consumeOtp(user.UserName, loginOtpPurpose, code, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.startSession(user.UserName, ctx)
+}
+
+// requestLoginLink emails a signed single use login link to a verified
+// email. The link carries an otp, so it expires, is rate limited and
+// locks like the other otps.
+func (u *UserStorage) requestLoginLink(email string, ctx context.Context) (string, error) {
+	// the response is the same whether or not the email is registered
+	message := "If the email is registered, a login link has been sent"
+
+	user, err := u.getUserByEmail(email, ctx)
+	if err != nil || !user.IsEmailVerified {
+		return message, nil
+	}
+
+	nonce, err := u.issueOtp(user.UserName, loginLinkPurpose, ctx)
+	if err != nil {
+		log.Printf("failed to issue login link for %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	token, err := jwtclaim.CreateLoginLinkToken(user.UserName, nonce, otpTTL)
+	if err != nil {
+		log.Printf("failed to sign login link for %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	// loginLinkUrl is checked when the server starts
+	link, _ := url.Parse(u.loginLinkUrl)
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = u.notifier.Notify(ctx, notifier.LoginLink, email, notifier.LinkData{Name: user.FirstName, Link: link.String(), ExpiresIn: otpTTL})
+	if err != nil {
+		log.Printf("failed to send login link to %s: %v", user.UserName, err)
+		return message, nil
+	}
+
+	return message, nil
+}
+
+func (u *UserStorage) loginWithLink(token string, ctx context.Context) (*authTokens, error) {
+	userName, nonce, err := jwtclaim.ParseLoginLinkToken(token)
+	if errors.Is(err, jwtclaim.ErrTokenExpired) {
+		return nil, errOtpExpired
+	}
+	if err != nil {
+		return nil, errOtpInvalid
+	}
+
+	err = u.consumeOtp(userName, loginLinkPurpose, nonce, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.startSession(userName, ctx)
+}
+
+func (u *UserStorage) getUserByMobile(mobile string, ctx context.Context) (*models.User, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {mobile:$mobile}) WHERE u.isMobileVerified RETURN u.userName AS userName, u.firstName AS firstName, u.mobile AS mobile",
+				map[string]interface{}{
+					"mobile": mobile,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonData, _ := json.Marshal(record.AsMap())
+			var user models.User
+			json.Unmarshal(jsonData, &user)
+
+			return &user, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := result.(*models.User)
+	if !ok {
+		return nil, errors.New("not able to convert")
+	}
+
+	return user, nil
+}
+
+// userNameChangeCooldown is how long a user has to wait between two
+// username changes.
+const userNameChangeCooldown = 30 * 24 * time.Hour
+
+var (
+	errUserNameTaken    = errors.New("username already exists")
+	errUserNameCooldown = errors.New("username was changed recently, try again later")
+)
+
+// changeUserName renames the user and keeps the old handle as a
+// UserNameHistory node, so lookups by the old handle still find the account.
+// Old handles stay reserved, only their owner can take them back. A fresh
+// access token carrying the new handle is returned.
+func (u *UserStorage) changeUserName(userName string, newUserName string, sessionId string, ctx context.Context) (string, error) {
+	if newUserName == userName {
+		return "", errors.New("new username is the same as the current one")
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	now := time.Now()
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         OPTIONAL MATCH (o:User {userName:$newUserName})
+         OPTIONAL MATCH (h:User)-[:HAD_USERNAME]->(:UserNameHistory {userName:$newUserName}) WHERE h <> u
+         RETURN coalesce(u.userName_changed_at + duration({seconds:$cooldown}) > datetime($now), false) AS onCooldown, count(o) + count(h) > 0 AS isTaken`,
+				map[string]interface{}{
+					"userName":    userName,
+					"newUserName": newUserName,
+					"cooldown":    int64(userNameChangeCooldown.Seconds()),
+					"now":         now.Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			onCooldown, _ := record.Get("onCooldown")
+			if onCooldown == true {
+				return errUserNameCooldown, nil
+			}
+			isTaken, _ := record.Get("isTaken")
+			if isTaken == true {
+				return errUserNameTaken, nil
+			}
+
+			// taking back one of your own old handles removes it from the history
+			_, err = tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         OPTIONAL MATCH (u)-[:HAD_USERNAME]->(own:UserNameHistory {userName:$newUserName})
+         DETACH DELETE own
+         WITH DISTINCT u
+         CREATE (u)-[:HAD_USERNAME]->(:UserNameHistory {userName:$userName, changed_at:datetime($now)})
+         SET u.userName=$newUserName, u.userName_changed_at=datetime($now), u.updated_at=datetime($now)`,
+				map[string]interface{}{
+					"userName":    userName,
+					"newUserName": newUserName,
+					"now":         now.Format(time.RFC3339),
+				},
+			)
+			return nil, err
+		})
+	if err != nil {
+		return "", err
+	}
+	if err, ok := result.(error); ok {
+		return "", err
+	}
+
+	return u.accessToken(newUserName, sessionId, ctx)
+}
+
+// userNameReserved reports whether userName is the old handle of some user.
+func (u *UserStorage) userNameReserved(userName string, ctx context.Context) bool {
+	return u.renamedUserName(userName, ctx) != ""
+}
+
+// renamedUserName returns the current handle of the user that had userName
+// before, or "" when userName is no old handle.
+func (u *UserStorage) renamedUserName(userName string, ctx context.Context) string {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, _ := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User)-[:HAD_USERNAME]->(:UserNameHistory {userName:$userName}) RETURN u.userName AS userName",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			userName, _ := record.Get("userName")
+			return userName.(string), nil
+		})
+
+	current, _ := result.(string)
+	return current
+}
+
+// currentUserName resolves an old handle sent in a request body to the
+// handle the user has now. Other names are returned as they are.
+func (u *UserStorage) currentUserName(userName string, ctx context.Context) string {
+	if u.userNameExists(userName, ctx) {
+		return userName
+	}
+	if current := u.renamedUserName(userName, ctx); current != "" {
+		return current
+	}
+	return userName
+}
+
+const (
+	emailChangeOtpPurpose       otpPurpose = "email_change"
+	emailChangeCancelOtpPurpose otpPurpose = "email_change_cancel"
+)
+
+var (
+	errEmailTaken        = errors.New("email already exists")
+	errIncorrectPassword = errors.New("incorrect password")
+)
+
+// reauthenticate checks that the caller of a sensitive change still holds
+// the account, either by its current password or, when two-factor
+// authentication is on, by a second factor code.
+func (u *UserStorage) reauthenticate(userName string, password string, code string, ctx context.Context) error {
+	if code != "" {
+		return u.verifySecondFactor(userName, code, ctx)
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN coalesce(u.password, '') AS password",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			password, _ := record.Get("password")
+			return password, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, _ := result.(string)
+	if hashedPassword == "" {
+		// accounts created through a provider have no password to check
+		hash.CheckPasswordHash(password, dummyPasswordHash())
+		return errIncorrectPassword
+	}
+	if !hash.CheckPasswordHash(password, hashedPassword) {
+		return errIncorrectPassword
+	}
+
+	return nil
+}
+
+// requestEmailChange keeps email as the pending email of the user and sends
+// it an otp. The current email stays in use for login and recovery until
+// confirmEmailChange is called with that otp, and gets a code that cancels
+// the change in the meantime.
+func (u *UserStorage) requestEmailChange(userName string, email string, password string, code string, ctx context.Context) (string, error) {
+	if err := u.reauthenticate(userName, password, code, ctx); err != nil {
+		return "", err
+	}
+
+	user, err := u.getUserContact(userName, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Email == email {
+		return "", errors.New("new email is the same as the current one")
+	}
+
+	if u.emailExists(email, ctx) {
+		return "", errEmailTaken
+	}
+
+	generatedOtp, err := u.issueOtp(userName, emailChangeOtpPurpose, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	cancelOtp, err := u.issueOtp(userName, emailChangeCancelOtpPurpose, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) SET u.pending_email=$email, u.updated_at=datetime($now)",
+				map[string]interface{}{
+					"userName": userName,
+					"email":    email,
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	// the current address hears about the change before the new one can
+	// confirm it
+	err = u.notifier.Notify(ctx, notifier.EmailChangeAlert, user.Email, notifier.EmailChangeAlertData{Name: user.FirstName, NewEmail: email, Otp: cancelOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		return "", err
+	}
+
+	err = u.notifier.Notify(ctx, notifier.ChangeEmailOtp, email, notifier.OtpData{Name: user.FirstName, Otp: generatedOtp, ExpiresIn: otpTTL})
+	if err != nil {
+		return "", err
+	}
+
+	return "Otp sent to the new email", nil
+}
+
+// cancelEmailChange drops the pending email of the account that currently
+// uses email, given the code sent to that address when the change was
+// requested.
+func (u *UserStorage) cancelEmailChange(email string, code string, ctx context.Context) (string, error) {
+	user, err := u.getUserByEmail(email, ctx)
+	if err != nil {
+		// same answer as a wrong code so accounts can't be discovered
+		return "", errOtpInvalid
+	}
+
+	err = u.consumeOtp(user.UserName, emailChangeCancelOtpPurpose, code, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	_, err = session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         OPTIONAL MATCH (u)-[:HAS_OTP]->(o:Otp {purpose:$purpose})
+         DETACH DELETE o
+         WITH DISTINCT u
+         SET u.updated_at=datetime($now)
+         REMOVE u.pending_email`,
+				map[string]interface{}{
+					"userName": user.UserName,
+					"purpose":  string(emailChangeOtpPurpose),
+					"now":      time.Now().Format(time.RFC3339),
+				},
+			)
+		})
+	if err != nil {
+		return "", err
+	}
+
+	return "Email change cancelled", nil
+}
+
+// confirmEmailChange swaps the pending email in once its otp is verified and
+// lets the old address know about the change.
+func (u *UserStorage) confirmEmailChange(userName string, code string, ctx context.Context) (string, error) {
+	session := u.db.NewSession(ctx, neo4j.SessionConfig{DatabaseName: u.dbName, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	pending, err := session.ExecuteRead(ctx,
+		func(tx neo4j.ManagedTransaction) (interface{}, error) {
+			result, err := tx.Run(ctx,
+				"MATCH (u:User {userName:$userName}) RETURN u.pending_email AS pendingEmail",
+				map[string]interface{}{
+					"userName": userName,
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			pendingEmail, _ := record.Get("pendingEmail")
+			return pendingEmail, nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	email, _ := pending.(string)
+	if email == "" {
+		return "", errors.New("no email change requested")
+	}
+
+	err = u.consumeOtp(userName, emailChangeOtpPurpose, code, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// someone else may have taken the address since it was requested
+	if u.emailExists(email, ctx) {
+		return "", errEmailTaken
+	}
+
+	result, err := session.ExecuteWrite(ctx,
+		func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx,
+				`MATCH (u:User {userName:$userName})
+         OPTIONAL MATCH (u)-[:HAS_OTP]->(o:Otp {purpose:$cancelPurpose})
+         DETACH DELETE o
+         WITH DISTINCT u, u.email AS oldEmail
+         SET u.email=$email, u.isEmailVerified=true, u.updated_at=datetime($now)
+         REMOVE u.pending_email
+         RETURN oldEmail, u.firstName AS firstName`,
+				map[string]interface{}{
+					"userName":      userName,
+					"email":         email,
+					"cancelPurpose": string(emailChangeCancelOtpPurpose),
+					"now":           time.Now().Format(time.RFC3339),
+				},
+			)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return record.AsMap(), nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	previous, _ := result.(map[string]any)
+	oldEmail, _ := previous["oldEmail"].(string)
+	firstName, _ := previous["firstName"].(string)
+
+	// the change already happened, a failed notice should not fail it
+	err = u.notifier.Notify(ctx, notifier.EmailChanged, oldEmail, notifier.EmailChangeData{Name: firstName, NewEmail: email})
+	if err != nil {
+		log.Printf("failed to notify %s about the email change: %v", userName, err)
+	}
+
+	return "Email changed successfully", nil
+}
@@ -0,0 +1,59 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	// UploadUrlTTL is how long a presigned upload url stays valid.
+	UploadUrlTTL = 15 * time.Minute
+	// DownloadUrlTTL is how long the urls handed out in responses stay valid.
+	DownloadUrlTTL = time.Hour
+)
+
+var (
+	ErrNotFound        = errors.New("object not found")
+	ErrInvalidUploadId = errors.New("invalid upload id")
+	ErrInvalidPart     = errors.New("invalid part")
+)
+
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// BlobStore keeps the uploaded media. Clients upload and download through
+// presigned urls, the api itself only inspects and deletes objects.
+type BlobStore interface {
+	PresignPut(ctx context.Context, key string, ttl time.Duration) (string, error)
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Head returns ErrNotFound when nothing is stored under key.
+	Head(ctx context.Context, key string) (*ObjectInfo, error)
+	// Get returns ErrNotFound when nothing is stored under key, the caller
+	// closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	// Delete succeeds when nothing is stored under key.
+	Delete(ctx context.Context, key string) error
+
+	// CreateMultipart starts an upload that is sent in parts and returns its
+	// upload id.
+	CreateMultipart(ctx context.Context, key string, contentType string) (string, error)
+	PresignPart(ctx context.Context, key string, uploadId string, partNumber int, ttl time.Duration) (string, error)
+	// CompleteMultipart joins the parts, in the order given, into the object
+	// stored under key.
+	CompleteMultipart(ctx context.Context, key string, uploadId string, parts []Part) error
+	// AbortMultipart discards the parts, it succeeds when the upload is
+	// already gone.
+	AbortMultipart(ctx context.Context, key string, uploadId string) error
+}
+
+// Part is an uploaded part of a multipart upload. ETag is the value the
+// store returned in the ETag header of the part upload.
+type Part struct {
+	Number int
+	ETag   string
+}
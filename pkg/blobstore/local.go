@@ -0,0 +1,374 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey       = errors.New("invalid key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrUrlExpired       = errors.New("url expired")
+)
+
+// LocalStore keeps objects on disk for development and tests. Its presigned
+// urls point at the routes of internal/blob, which check the signature with
+// Verify before reading or writing.
+type LocalStore struct {
+	dir     string
+	baseUrl string
+	secret  []byte
+}
+
+// NewLocalStore stores objects under dir. baseUrl is the public url the
+// blob routes are served at. Urls signed with a random secret stop working
+// once the process restarts, so an empty secret is only fit for tests.
+func NewLocalStore(dir string, baseUrl string, secret string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("BLOB_DIR is required")
+	}
+	if baseUrl == "" {
+		return nil, errors.New("BLOB_URL is required")
+	}
+
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sub := range []string{"objects", "meta", "parts"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LocalStore{
+		dir:     dir,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		secret:  key,
+	}, nil
+}
+
+func (l *LocalStore) PresignPut(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return l.presign(http.MethodPut, key, ttl)
+}
+
+func (l *LocalStore) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return l.presign(http.MethodGet, key, ttl)
+}
+
+func (l *LocalStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	objectPath, metaPath, err := l.paths(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(objectPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := os.ReadFile(metaPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Size:        stat.Size(),
+		ContentType: string(contentType),
+	}, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	objectPath, metaPath, err := l.paths(key)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{objectPath, metaPath} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return l.Open(key)
+}
+
+func (l *LocalStore) Put(ctx context.Context, key string, contentType string, data []byte) error {
+	return l.Write(key, contentType, bytes.NewReader(data))
+}
+
+// Write stores the object under key, replacing what was there.
+func (l *LocalStore) Write(key string, contentType string, body io.Reader) error {
+	objectPath, metaPath, err := l.paths(key)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(metaPath, []byte(contentType), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), objectPath)
+}
+
+// Open returns the object stored under key, the caller closes it.
+func (l *LocalStore) Open(key string) (*os.File, error) {
+	objectPath, _, err := l.paths(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(objectPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Verify checks the expires and signature query parameters of a presigned
+// url for method and key.
+func (l *LocalStore) Verify(method string, key string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := l.sign(method, key, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return ErrUrlExpired
+	}
+	return nil
+}
+
+func (l *LocalStore) CreateMultipart(ctx context.Context, key string, contentType string) (string, error) {
+	if _, _, err := l.paths(key); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadId := hex.EncodeToString(id)
+
+	uploadDir, err := l.uploadDir(uploadId)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		return "", err
+	}
+	// the upload remembers its key and content type for CompleteMultipart
+	err = os.WriteFile(filepath.Join(uploadDir, "upload"), []byte(key+"\n"+contentType), 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	return uploadId, nil
+}
+
+func (l *LocalStore) PresignPart(ctx context.Context, key string, uploadId string, partNumber int, ttl time.Duration) (string, error) {
+	if _, _, err := l.paths(key); err != nil {
+		return "", err
+	}
+	if _, err := l.uploadDir(uploadId); err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("uploadId", uploadId)
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", l.sign(http.MethodPut, partResource(key, uploadId, partNumber), expiresAt))
+
+	return l.baseUrl + "/" + url.PathEscape(key) + "?" + query.Encode(), nil
+}
+
+// VerifyPart checks the presigned url of a part like Verify does for
+// objects.
+func (l *LocalStore) VerifyPart(key string, uploadId string, partNumber int, expires string, signature string) error {
+	return l.Verify(http.MethodPut, partResource(key, uploadId, partNumber), expires, signature)
+}
+
+// WritePart stores a part of the multipart upload of key and returns its
+// ETag.
+func (l *LocalStore) WritePart(key string, uploadId string, partNumber int, body io.Reader) (string, error) {
+	uploadDir, _, err := l.upload(key, uploadId)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(uploadDir, ".part-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(uploadDir, strconv.Itoa(partNumber))); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q", hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+func (l *LocalStore) CompleteMultipart(ctx context.Context, key string, uploadId string, parts []Part) error {
+	uploadDir, contentType, err := l.upload(key, uploadId)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return ErrInvalidPart
+	}
+
+	var readers []io.Reader
+	for i, part := range parts {
+		if i > 0 && part.Number <= parts[i-1].Number {
+			return ErrInvalidPart
+		}
+
+		data, err := os.ReadFile(filepath.Join(uploadDir, strconv.Itoa(part.Number)))
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrInvalidPart
+		}
+		if err != nil {
+			return err
+		}
+
+		sum := md5.Sum(data)
+		if strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			return ErrInvalidPart
+		}
+		readers = append(readers, bytes.NewReader(data))
+	}
+
+	if err := l.Write(key, contentType, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(uploadDir)
+}
+
+func (l *LocalStore) AbortMultipart(ctx context.Context, key string, uploadId string) error {
+	uploadDir, err := l.uploadDir(uploadId)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(uploadDir)
+}
+
+func (l *LocalStore) presign(method string, key string, ttl time.Duration) (string, error) {
+	if _, _, err := l.paths(key); err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", l.sign(method, key, expiresAt))
+
+	return l.baseUrl + "/" + url.PathEscape(key) + "?" + query.Encode(), nil
+}
+
+func (l *LocalStore) sign(method string, key string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// paths maps key to its object and metadata files. Keys are single path
+// segments so they can't point outside of the store.
+func (l *LocalStore) paths(key string) (string, string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", "", ErrInvalidKey
+	}
+
+	return filepath.Join(l.dir, "objects", key), filepath.Join(l.dir, "meta", key), nil
+}
+
+// uploadDir is where the parts of a multipart upload are kept. Upload ids
+// are hex strings so they can't point outside of the store.
+func (l *LocalStore) uploadDir(uploadId string) (string, error) {
+	if _, err := hex.DecodeString(uploadId); err != nil || uploadId == "" {
+		return "", ErrInvalidUploadId
+	}
+
+	return filepath.Join(l.dir, "parts", uploadId), nil
+}
+
+// upload returns the directory and content type of a multipart upload
+// started for key.
+func (l *LocalStore) upload(key string, uploadId string) (string, string, error) {
+	uploadDir, err := l.uploadDir(uploadId)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(uploadDir, "upload"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", ErrInvalidUploadId
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadKey, contentType, _ := strings.Cut(string(data), "\n")
+	if uploadKey != key {
+		return "", "", ErrInvalidUploadId
+	}
+	return uploadDir, contentType, nil
+}
+
+func partResource(key string, uploadId string, partNumber int) string {
+	return key + "\n" + uploadId + "\n" + strconv.Itoa(partNumber)
+}
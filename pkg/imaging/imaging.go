@@ -0,0 +1,224 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/zone/IStyle/pkg/blurhash"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Variant is a resized copy of an image, at most Width pixels wide.
+type Variant struct {
+	Name  string
+	Width int
+}
+
+var Variants = []Variant{
+	{Name: "small", Width: 320},
+	{Name: "medium", Width: 640},
+	{Name: "large", Width: 1080},
+}
+
+const (
+	variantQuality  = 82
+	strippedQuality = 90
+	// placeholderSize is the width of the thumbnail the blurhash and the
+	// dominant color are computed from
+	placeholderSize = 32
+	// MaxPixels bounds the size of the images that are decoded, a small
+	// file can claim dimensions that need gigabytes once decoded
+	MaxPixels = 40_000_000
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = fmt.Errorf("image larger than %d megapixels", MaxPixels/1_000_000)
+)
+
+// VariantKey is the blob key the variant of the image stored under key is
+// kept at.
+func VariantKey(key string, variant Variant) string {
+	return fmt.Sprintf("%s_%d", key, variant.Width)
+}
+
+// VariantKeys returns the keys of every variant of key.
+func VariantKeys(key string) []string {
+	keys := make([]string, 0, len(Variants))
+	for _, variant := range Variants {
+		keys = append(keys, VariantKey(key, variant))
+	}
+	return keys
+}
+
+type Encoded struct {
+	Data        []byte
+	ContentType string
+}
+
+type Result struct {
+	// Stripped is the original re-encoded without any metadata
+	Stripped Encoded
+	// Variants are JPEG encoded, by variant name
+	Variants      map[string]Encoded
+	Blurhash      string
+	DominantColor string
+	Width         int
+	Height        int
+}
+
+// Process decodes a JPEG, PNG or WebP image, applies its EXIF orientation
+// and returns a metadata free copy together with the resized variants and
+// the placeholder details. Images above MaxPixels are not decoded.
+func Process(r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	stripped, err := strip(img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// jpeg has no alpha channel, transparent parts turn white
+	flat := flatten(img)
+	bounds := flat.Bounds()
+
+	variants := make(map[string]Encoded, len(Variants))
+	for _, variant := range Variants {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, resize(flat, variant.Width), &jpeg.Options{Quality: variantQuality})
+		if err != nil {
+			return nil, err
+		}
+		variants[variant.Name] = Encoded{Data: buf.Bytes(), ContentType: "image/jpeg"}
+	}
+
+	thumbnail := resize(flat, placeholderSize)
+	hash, err := blurhash.Encode(thumbnail, 4, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Stripped:      stripped,
+		Variants:      variants,
+		Blurhash:      hash,
+		DominantColor: dominantColor(thumbnail),
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+	}, nil
+}
+
+// strip re-encodes img, which drops every metadata block of the original.
+// Only PNG keeps its format, anything else becomes a JPEG.
+func strip(img image.Image, format string) (Encoded, error) {
+	var buf bytes.Buffer
+	if format == "png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return Encoded{}, err
+		}
+		return Encoded{Data: buf.Bytes(), ContentType: "image/png"}, nil
+	}
+
+	if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: strippedQuality}); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg"}, nil
+}
+
+func flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+	return flat
+}
+
+// resize scales img down to width keeping the aspect ratio. Images that are
+// narrower already are returned as they are.
+func resize(img *image.RGBA, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	return resized
+}
+
+// dominantColor returns the average color of the most common bucket when
+// the colors are reduced to 4 bits per channel, as #rrggbb.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+
+	var best *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+
+			index := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			current, ok := buckets[index]
+			if !ok {
+				current = &bucket{}
+				buckets[index] = current
+			}
+			current.count++
+			current.r += int(r)
+			current.g += int(g)
+			current.b += int(b)
+
+			if best == nil || current.count > best.count {
+				best = current
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
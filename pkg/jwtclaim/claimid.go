@@ -1,72 +1,55 @@
 package jwtclaim
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL is kept short, clients renew access tokens with the
+// refresh token of their session.
+const AccessTokenTTL = 15 * time.Minute
+
 type UserClaim struct {
-	UserName   string `json:"userName"`
-	IsVerified bool   `json:"isVerified"`
+	UserName  string    `json:"userName"`
+	State     UserState `json:"state"`
+	Role      Role      `json:"role"`
+	SessionId string    `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func CreateJwtToken(userName string, isVerified bool) (string, error) {
+func CreateJwtToken(userName string, sessionId string, state UserState, role Role) (string, error) {
 
 	claims := UserClaim{
 		userName,
-		isVerified,
+		state,
+		role,
+		sessionId,
 		jwt.RegisteredClaims{
 			// A usual scenario is to set the expiration time relative to the current time
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(240 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	var jwtKey = []byte("my_secret_key")
-	jsonWebToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := jsonWebToken.SignedString(jwtKey)
-
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return keySet.sign(claims)
 }
 
-func ExtractVerifyUsername(tokenStr string) (string, bool) {
-	hmacSecretString := "my_secret_key"
-	hmacSecret := []byte(hmacSecretString)
-
-	token, err := jwt.ParseWithClaims(tokenStr, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return hmacSecret, nil
-	}, jwt.WithLeeway(5*time.Second))
+func ParseToken(tokenStr string) (*UserClaim, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &UserClaim{}, keySet.keyFunc, jwt.WithLeeway(5*time.Second))
 
 	if err != nil {
-		return "", false
+		return nil, err
 	}
 	if claims, ok := token.Claims.(*UserClaim); ok && token.Valid {
-		return claims.UserName, ok
-	} else {
-		return "", false
-	}
-}
-func ExtractUsername(tokenStr string) (string, bool) {
-	hmacSecretString := "my_secret_key"
-	hmacSecret := []byte(hmacSecretString)
-
-	token, err := jwt.ParseWithClaims(tokenStr, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return hmacSecret, nil
-	}, jwt.WithLeeway(5*time.Second))
-
-	if err != nil {
-		return "", false
-	}
-	if claims, ok := token.Claims.(*UserClaim); ok && token.Valid && claims.IsVerified {
-		return claims.UserName, ok
-	} else {
-		return "", false
+		// access tokens carry no audience, tokens that have one were issued
+		// for a single purpose like the second login step
+		if len(claims.Audience) > 0 {
+			return nil, errors.New("invalid token")
+		}
+		return claims, nil
 	}
+	return nil, errors.New("invalid token")
 }
@@ -0,0 +1,248 @@
+package jwtclaim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single signing key identified by its kid. Keys loaded without
+// private material can only verify tokens, which is how retired keys are
+// kept around until the tokens they signed have expired.
+type Key struct {
+	Id        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+var keySet *KeySet
+
+// SetKeySet installs the keys used by CreateJwtToken and ParseToken.
+func SetKeySet(keys *KeySet) {
+	keySet = keys
+}
+
+// keyFile is the format of JWT_KEYS_FILE:
+//
+//	{
+//	  "signingKey": "2024-02",
+//	  "keys": [
+//	    {"kid": "2024-02", "alg": "EdDSA", "privateKeyFile": "keys/2024-02.pem"},
+//	    {"kid": "2024-01", "alg": "RS256", "publicKeyFile": "keys/2024-01.pub.pem"},
+//	    {"kid": "legacy", "alg": "HS256", "secret": "..."}
+//	  ]
+//	}
+type keyFile struct {
+	SigningKey string        `json:"signingKey"`
+	Keys       []keyFileItem `json:"keys"`
+}
+
+type keyFileItem struct {
+	Id             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret"`
+	PrivateKeyFile string `json:"privateKeyFile"`
+	PublicKeyFile  string `json:"publicKeyFile"`
+}
+
+// LoadKeySet reads the keys from path, or falls back to a single HS256 key
+// built from secret when no key file is configured.
+func LoadKeySet(path string, secret string) (*KeySet, error) {
+	if path == "" {
+		if secret == "" {
+			return nil, errors.New("JWT_KEYS_FILE or JWT_SECRET is required")
+		}
+		key := &Key{Id: "default", Algorithm: jwt.SigningMethodHS256.Alg(), signKey: []byte(secret), verifyKey: []byte(secret)}
+		return &KeySet{signing: key, keys: map[string]*Key{key.Id: key}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+	for _, item := range file.Keys {
+		key, err := loadKey(item)
+		if err != nil {
+			return nil, errors.New("key " + item.Id + ": " + err.Error())
+		}
+		set.keys[key.Id] = key
+	}
+
+	signing, ok := set.keys[file.SigningKey]
+	if !ok || signing.signKey == nil {
+		return nil, errors.New("signing key " + file.SigningKey + " is missing or has no private key")
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+func loadKey(item keyFileItem) (*Key, error) {
+	if item.Id == "" {
+		return nil, errors.New("kid is required")
+	}
+
+	key := &Key{Id: item.Id, Algorithm: item.Algorithm}
+
+	switch item.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		if item.Secret == "" {
+			return nil, errors.New("secret is required")
+		}
+		key.signKey = []byte(item.Secret)
+		key.verifyKey = []byte(item.Secret)
+
+	case jwt.SigningMethodRS256.Alg():
+		if item.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(item.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else {
+			pem, err := os.ReadFile(item.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+
+	case jwt.SigningMethodEdDSA.Alg():
+		if item.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(item.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = private.(crypto.Signer).Public()
+		} else {
+			pem, err := os.ReadFile(item.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+
+	default:
+		return nil, errors.New("unsupported alg " + item.Algorithm)
+	}
+
+	return key, nil
+}
+
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	if k == nil || k.signing == nil {
+		return "", errors.New("no signing key configured")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.signing.Algorithm), claims)
+	token.Header["kid"] = k.signing.Id
+
+	return token.SignedString(k.signing.signKey)
+}
+
+// keyFunc resolves the verification key from the kid header and makes sure
+// the token was signed with the algorithm registered for that key.
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if k == nil {
+		return nil, errors.New("no keys configured")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown kid")
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.verifyKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS lists the public part of every asymmetric key. HS256 keys are
+// shared secrets and are never published.
+func PublicJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if keySet == nil {
+		return jwks
+	}
+
+	for _, key := range keySet.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.Id,
+				Alg: key.Algorithm,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.Id,
+				Alg: key.Algorithm,
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return jwks
+}
@@ -0,0 +1,51 @@
+package jwtclaim
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// loginLinkAudience marks tokens sent in login links.
+const loginLinkAudience = "login_link"
+
+// ErrTokenExpired is returned for tokens that were valid but have expired.
+var ErrTokenExpired = jwt.ErrTokenExpired
+
+type loginLinkClaim struct {
+	UserName string `json:"userName"`
+	Nonce    string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// CreateLoginLinkToken signs the token of a login link. The nonce is what
+// makes the link single use, the caller stores it and consumes it on login.
+func CreateLoginLinkToken(userName string, nonce string, ttl time.Duration) (string, error) {
+	claims := loginLinkClaim{
+		userName,
+		nonce,
+		jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{loginLinkAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keySet.sign(claims)
+}
+
+// ParseLoginLinkToken returns the user name and nonce of a token created by
+// CreateLoginLinkToken.
+func ParseLoginLinkToken(tokenStr string) (string, string, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &loginLinkClaim{}, keySet.keyFunc, jwt.WithLeeway(5*time.Second), jwt.WithAudience(loginLinkAudience))
+
+	if err != nil {
+		return "", "", err
+	}
+	if claims, ok := token.Claims.(*loginLinkClaim); ok && token.Valid {
+		return claims.UserName, claims.Nonce, nil
+	}
+	return "", "", errors.New("invalid token")
+}
@@ -0,0 +1,48 @@
+package jwtclaim
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MfaTokenTTL bounds how long a user has to enter the second factor after
+// the password was accepted.
+const MfaTokenTTL = 5 * time.Minute
+
+// mfaAudience marks tokens that only prove the first login factor. They are
+// not bound to a session and are rejected by ParseToken.
+const mfaAudience = "mfa"
+
+type mfaClaim struct {
+	UserName string `json:"userName"`
+	jwt.RegisteredClaims
+}
+
+func CreateMfaToken(userName string) (string, error) {
+	claims := mfaClaim{
+		userName,
+		jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MfaTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keySet.sign(claims)
+}
+
+// ParseMfaToken returns the user name of a token created by CreateMfaToken.
+func ParseMfaToken(tokenStr string) (string, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &mfaClaim{}, keySet.keyFunc, jwt.WithLeeway(5*time.Second), jwt.WithAudience(mfaAudience))
+
+	if err != nil {
+		return "", err
+	}
+	if claims, ok := token.Claims.(*mfaClaim); ok && token.Valid {
+		return claims.UserName, nil
+	}
+	return "", errors.New("invalid token")
+}
@@ -0,0 +1,30 @@
+package jwtclaim
+
+// Role grants access to management endpoints. Roles are ordered, a role
+// includes every permission of the roles below it.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleOrder = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleOrder[r]
+	return ok
+}
+
+func (r Role) AtLeast(required Role) bool {
+	current, ok := roleOrder[r]
+	if !ok {
+		return false
+	}
+	return current >= roleOrder[required]
+}
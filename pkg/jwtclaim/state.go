@@ -0,0 +1,52 @@
+package jwtclaim
+
+// UserState is the step of the sign up flow a user has reached. The states
+// are ordered, every state implies the ones before it.
+type UserState string
+
+const (
+	StateRegistered     UserState = "registered"
+	StateEmailVerified  UserState = "email_verified"
+	StateMobileVerified UserState = "mobile_verified"
+	StateOnboarded      UserState = "onboarded"
+)
+
+var stateOrder = map[UserState]int{
+	StateRegistered:     0,
+	StateEmailVerified:  1,
+	StateMobileVerified: 2,
+	StateOnboarded:      3,
+}
+
+func StateFor(isEmailVerified bool, isMobileVerified bool, isComplete bool) UserState {
+	switch {
+	case isEmailVerified && isMobileVerified && isComplete:
+		return StateOnboarded
+	case isEmailVerified && isMobileVerified:
+		return StateMobileVerified
+	case isEmailVerified:
+		return StateEmailVerified
+	}
+	return StateRegistered
+}
+
+func (s UserState) AtLeast(required UserState) bool {
+	current, ok := stateOrder[s]
+	if !ok {
+		return false
+	}
+	return current >= stateOrder[required]
+}
+
+// NextStep names the action that moves a user out of state s.
+func (s UserState) NextStep() string {
+	switch s {
+	case StateRegistered:
+		return "verify_email"
+	case StateEmailVerified:
+		return "verify_mobile"
+	case StateMobileVerified:
+		return "complete_onboarding"
+	}
+	return ""
+}
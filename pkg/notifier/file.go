@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileNotifier writes messages to a file or stdout instead of delivering
+// them. It is meant for local development and tests.
+type FileNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	if path == "" || path == "-" {
+		return &FileNotifier{w: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileNotifier{w: file}, nil
+}
+
+func (f *FileNotifier) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err := fmt.Fprintf(f.w, "[%s] %s to=%s subject=%q\n%s\n\n", time.Now().Format(time.RFC3339), msg.Channel, msg.To, msg.Subject, msg.Body)
+	return err
+}
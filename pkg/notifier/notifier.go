@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+)
+
+type Channel string
+
+const (
+	Email Channel = "email"
+	SMS   Channel = "sms"
+)
+
+type Message struct {
+	Channel Channel
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers a rendered message to a single recipient.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Dispatcher renders templated messages and routes them to the notifier
+// registered for the template's channel.
+type Dispatcher struct {
+	email Notifier
+	sms   Notifier
+}
+
+func NewDispatcher(email Notifier, sms Notifier) *Dispatcher {
+	return &Dispatcher{
+		email: email,
+		sms:   sms,
+	}
+}
+
+func (d *Dispatcher) Send(ctx context.Context, msg Message) error {
+	switch msg.Channel {
+	case Email:
+		if d.email == nil {
+			return errors.New("email notifier not configured")
+		}
+		return d.email.Send(ctx, msg)
+	case SMS:
+		if d.sms == nil {
+			return errors.New("sms notifier not configured")
+		}
+		return d.sms.Send(ctx, msg)
+	}
+
+	return errors.New("unknown channel")
+}
+
+func (d *Dispatcher) Notify(ctx context.Context, name Template, to string, data any) error {
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return err
+	}
+
+	return d.Send(ctx, msg)
+}
@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SMSNotifier posts messages to an HTTP SMS gateway as
+// {"from":..., "to":..., "body":...} using bearer authentication.
+type SMSNotifier struct {
+	apiUrl string
+	apiKey string
+	sender string
+	client *http.Client
+}
+
+func NewSMSNotifier(apiUrl string, apiKey string, sender string) *SMSNotifier {
+	return &SMSNotifier{
+		apiUrl: apiUrl,
+		apiKey: apiKey,
+		sender: sender,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *SMSNotifier) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]string{
+		"from": s.sender,
+		"to":   msg.To,
+		"body": msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("sms gateway responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"text/template"
+	"time"
+)
+
+type Template string
+
+const (
+	VerifyEmailOtp   Template = "verify_email_otp"
+	VerifyMobileOtp  Template = "verify_mobile_otp"
+	PasswordResetOtp Template = "password_reset_otp"
+	LoginOtp         Template = "login_otp"
+	LoginLink        Template = "login_link"
+	ChangeEmailOtp   Template = "change_email_otp"
+	EmailChanged     Template = "email_changed"
+	EmailChangeAlert Template = "email_change_alert"
+)
+
+type messageTemplate struct {
+	channel Channel
+	subject *template.Template
+	body    *template.Template
+}
+
+func newTemplate(channel Channel, subject string, body string) messageTemplate {
+	return messageTemplate{
+		channel: channel,
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+var templates = map[Template]messageTemplate{
+	VerifyEmailOtp: newTemplate(Email,
+		"Verify your IStyle email",
+		"Hi {{.Name}},\n\nYour IStyle verification code is {{.Otp}}. It expires in {{.ExpiryMinutes}} minutes.\n\nIf you did not sign up, you can ignore this email.\n",
+	),
+	PasswordResetOtp: newTemplate(Email,
+		"Reset your IStyle password",
+		"Hi {{.Name}},\n\nUse {{.Otp}} to reset your IStyle password. It expires in {{.ExpiryMinutes}} minutes.\n\nIf you did not ask for a password reset, you can ignore this email.\n",
+	),
+	VerifyMobileOtp: newTemplate(SMS,
+		"",
+		"{{.Otp}} is your IStyle verification code. It expires in {{.ExpiryMinutes}} minutes.",
+	),
+	LoginOtp: newTemplate(SMS,
+		"",
+		"{{.Otp}} is your IStyle login code. It expires in {{.ExpiryMinutes}} minutes. Never share it with anyone.",
+	),
+	LoginLink: newTemplate(Email,
+		"Your IStyle login link",
+		"Hi {{.Name}},\n\nUse this link to log in to IStyle:\n\n{{.Link}}\n\nIt expires in {{.ExpiryMinutes}} minutes and works once.\n\nIf you did not ask to log in, you can ignore this email.\n",
+	),
+	ChangeEmailOtp: newTemplate(Email,
+		"Confirm your new IStyle email",
+		"Hi {{.Name}},\n\nUse {{.Otp}} to confirm this address as your new IStyle email. It expires in {{.ExpiryMinutes}} minutes.\n\nIf you did not ask to change your email, you can ignore this email.\n",
+	),
+	EmailChanged: newTemplate(Email,
+		"Your IStyle email was changed",
+		"Hi {{.Name}},\n\nThe email of your IStyle account was changed to {{.NewEmail}}. This address will no longer receive messages from us.\n\nIf you did not make this change, contact support right away.\n",
+	),
+	EmailChangeAlert: newTemplate(Email,
+		"Your IStyle email is about to change",
+		"Hi {{.Name}},\n\nSomeone asked to change the email of your IStyle account to {{.NewEmail}}.\n\nIf this was not you, use {{.Otp}} to cancel the change and change your password. The code expires in {{.ExpiryMinutes}} minutes.\n",
+	),
+}
+
+// OtpData is the data passed to the otp templates.
+type OtpData struct {
+	Name      string
+	Otp       string
+	ExpiresIn time.Duration
+}
+
+func (d OtpData) ExpiryMinutes() int {
+	return int(d.ExpiresIn.Minutes())
+}
+
+// LinkData is the data passed to the templates that carry a link.
+type LinkData struct {
+	Name      string
+	Link      string
+	ExpiresIn time.Duration
+}
+
+func (d LinkData) ExpiryMinutes() int {
+	return int(d.ExpiresIn.Minutes())
+}
+
+// EmailChangeData is the data passed to the email changed template.
+type EmailChangeData struct {
+	Name     string
+	NewEmail string
+}
+
+// EmailChangeAlertData is the data passed to the email change alert
+// template, Otp cancels the change.
+type EmailChangeAlertData struct {
+	Name      string
+	NewEmail  string
+	Otp       string
+	ExpiresIn time.Duration
+}
+
+func (d EmailChangeAlertData) ExpiryMinutes() int {
+	return int(d.ExpiresIn.Minutes())
+}
+
+func Render(name Template, to string, data any) (Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return Message{}, errors.New("unknown template")
+	}
+
+	var subject bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Channel: tmpl.channel,
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
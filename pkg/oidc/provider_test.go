@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientId = "test-client"
+	testKid      = "test-key"
+)
+
+// mockIdP serves OpenID discovery and a JWKS with a single RSA key, and
+// signs ID tokens with it.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   idp.server.URL,
+			"jwks_uri": idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "RSA",
+			Kid: testKid,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) verifier() *Verifier {
+	return NewVerifier(map[string]ProviderConfig{
+		"mock": {Issuer: idp.server.URL, ClientId: testClientId},
+	})
+}
+
+// claims returns the claims of a valid token, for the tests to adjust.
+func (idp *mockIdP) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientId,
+		"sub":            "subject-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	}
+}
+
+func (idp *mockIdP) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	idp := newMockIdP(t)
+
+	identity, err := idp.verifier().Verify(context.Background(), "mock", idp.sign(t, testKid, idp.claims()))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	want := Identity{
+		Provider:      "mock",
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		FirstName:     "Jane",
+		LastName:      "Doe",
+	}
+	if *identity != want {
+		t.Errorf("Verify() = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	idp := newMockIdP(t)
+
+	tests := []struct {
+		name   string
+		kid    string
+		modify func(jwt.MapClaims)
+	}{
+		{
+			name:   "wrong issuer",
+			kid:    testKid,
+			modify: func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" },
+		},
+		{
+			name:   "wrong audience",
+			kid:    testKid,
+			modify: func(c jwt.MapClaims) { c["aud"] = "another-client" },
+		},
+		{
+			name:   "expired",
+			kid:    testKid,
+			modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		},
+		{
+			name:   "missing expiry",
+			kid:    testKid,
+			modify: func(c jwt.MapClaims) { delete(c, "exp") },
+		},
+		{
+			name:   "missing subject",
+			kid:    testKid,
+			modify: func(c jwt.MapClaims) { delete(c, "sub") },
+		},
+		{
+			name:   "unknown kid",
+			kid:    "rotated-away",
+			modify: func(c jwt.MapClaims) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims()
+			tt.modify(claims)
+
+			_, err := idp.verifier().Verify(context.Background(), "mock", idp.sign(t, tt.kid, claims))
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	idp := newMockIdP(t)
+	other := newMockIdP(t)
+
+	// signed by another key under the kid the provider publishes
+	_, err := idp.verifier().Verify(context.Background(), "mock", other.sign(t, testKid, idp.claims()))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestVerifyEmailVerified(t *testing.T) {
+	idp := newMockIdP(t)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{name: "false", value: false, want: false},
+		{name: "missing", value: nil, want: false},
+		// Apple sends the claim as a string
+		{name: "string true", value: "true", want: true},
+		{name: "string false", value: "false", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims()
+			if tt.value == nil {
+				delete(claims, "email_verified")
+			} else {
+				claims["email_verified"] = tt.value
+			}
+
+			identity, err := idp.verifier().Verify(context.Background(), "mock", idp.sign(t, testKid, claims))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if identity.EmailVerified != tt.want {
+				t.Errorf("EmailVerified = %v, want %v", identity.EmailVerified, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownProvider(t *testing.T) {
+	idp := newMockIdP(t)
+
+	_, err := idp.verifier().Verify(context.Background(), "other", idp.sign(t, testKid, idp.claims()))
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrUnknownProvider)
+	}
+}
@@ -2,6 +2,9 @@ package otp
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"io"
 )
 
@@ -18,3 +21,13 @@ func EncodeToString(max int) string {
 	}
 	return string(b)
 }
+
+// Hash returns the digest stored in place of the plain code.
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func Matches(code string, hashed string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(code)), []byte(hashed)) == 1
+}
@@ -0,0 +1,71 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachedList holds SHA-1 hashes of breached passwords grouped by their
+// five character prefix, the k-anonymity layout of the Pwned Passwords range
+// API, so a lookup only ever touches the suffixes of one prefix.
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachedList reads a file with one uppercase or lowercase SHA-1 hash
+// per line, optionally followed by ":count" as in the Pwned Passwords
+// downloads. Lines starting with "#" are ignored.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{ranges: map[string]map[string]struct{}{}}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hashed, _, _ := strings.Cut(text, ":")
+		hashed = strings.ToUpper(hashed)
+		if len(hashed) != sha1.Size*2 {
+			return nil, errors.New("invalid hash on line " + strconv.Itoa(line) + " of " + path)
+		}
+
+		prefix, suffix := hashed[:prefixLength], hashed[prefixLength:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = map[string]struct{}{}
+		}
+		list.ranges[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Range returns the hash suffixes known for prefix.
+func (b *BreachedList) Range(prefix string) map[string]struct{} {
+	return b.ranges[strings.ToUpper(prefix)]
+}
+
+func (b *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hashed := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := b.Range(hashed[:prefixLength])[hashed[prefixLength:]]
+	return found
+}
@@ -0,0 +1,144 @@
+package password
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxLength is where bcrypt stops looking at the password.
+const maxLength = 72
+
+const defaultMinLength = 8
+
+type Class string
+
+const (
+	ClassUpper  Class = "upper"
+	ClassLower  Class = "lower"
+	ClassDigit  Class = "digit"
+	ClassSymbol Class = "symbol"
+)
+
+// Violation is one reason a password was rejected. Code is stable for
+// clients, Message is meant for people.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet the requirements"
+}
+
+type Policy struct {
+	MinLength       int
+	RequiredClasses []Class
+	Breached        *BreachedList
+}
+
+// LoadPolicy builds the policy from its config values. minLength defaults
+// to 8 and no character classes are required unless listed in classes,
+// e.g. "upper,lower,digit". Length and the breached password check do most
+// of the work.
+func LoadPolicy(minLength string, classes string, breachedFile string) (*Policy, error) {
+	policy := &Policy{MinLength: defaultMinLength}
+
+	if minLength != "" {
+		value, err := strconv.Atoi(minLength)
+		if err != nil || value < 1 || value > maxLength {
+			return nil, errors.New("invalid PASSWORD_MIN_LEN " + minLength)
+		}
+		policy.MinLength = value
+	}
+
+	for _, class := range strings.Split(classes, ",") {
+		class = strings.TrimSpace(class)
+		switch Class(class) {
+		case "":
+		case ClassUpper, ClassLower, ClassDigit, ClassSymbol:
+			policy.RequiredClasses = append(policy.RequiredClasses, Class(class))
+		default:
+			return nil, errors.New("unknown password character class " + class)
+		}
+	}
+
+	if breachedFile != "" {
+		breached, err := LoadBreachedList(breachedFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// Check returns a *PolicyError listing every rule password breaks.
+// identifiers are the user name, email and similar values the password must
+// not contain.
+func (p *Policy) Check(password string, identifiers ...string) error {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{"too_short", "must be at least " + strconv.Itoa(p.MinLength) + " characters long"})
+	}
+	if len(password) > maxLength {
+		violations = append(violations, Violation{"too_long", "must be at most " + strconv.Itoa(maxLength) + " bytes long"})
+	}
+
+	for _, class := range p.RequiredClasses {
+		if !containsClass(password, class) {
+			violations = append(violations, Violation{"missing_" + string(class), "must contain " + classNames[class]})
+		}
+	}
+
+	lowered := strings.ToLower(password)
+	for _, identifier := range identifiers {
+		identifier = strings.ToLower(identifier)
+		if local, _, found := strings.Cut(identifier, "@"); found {
+			identifier = local
+		}
+		// very short identifiers would reject too many passwords
+		if len(identifier) >= 3 && strings.Contains(lowered, identifier) {
+			violations = append(violations, Violation{"contains_identifier", "must not contain your username or email"})
+			break
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{"breached", "has appeared in a data breach, choose a different one"})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+var classNames = map[Class]string{
+	ClassUpper:  "an uppercase letter",
+	ClassLower:  "a lowercase letter",
+	ClassDigit:  "a digit",
+	ClassSymbol: "a symbol",
+}
+
+func containsClass(password string, class Class) bool {
+	for _, r := range password {
+		switch {
+		case class == ClassUpper && unicode.IsUpper(r),
+			class == ClassLower && unicode.IsLower(r),
+			class == ClassDigit && unicode.IsDigit(r),
+			class == ClassSymbol && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r):
+			return true
+		}
+	}
+	return false
+}
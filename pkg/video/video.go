@@ -0,0 +1,97 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// ErrNoVideoStream is returned by Probe for files without a video stream.
+var ErrNoVideoStream = errors.New("no video stream")
+
+type Info struct {
+	// Duration is in seconds
+	Duration float64
+	Width    int
+	Height   int
+}
+
+// PosterKey is the blob key the poster frame of the video stored under key
+// is kept at.
+func PosterKey(key string) string {
+	return key + "_poster"
+}
+
+type probeOutput struct {
+	Streams []struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe reads the duration and dimensions of the video at path with
+// ffprobe, which has to be on the PATH.
+func Probe(ctx context.Context, path string) (*Info, error) {
+	output, err := run(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration",
+		"-of", "json",
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+	if len(probe.Streams) == 0 {
+		return nil, ErrNoVideoStream
+	}
+
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", probe.Format.Duration)
+	}
+
+	return &Info{
+		Duration: duration,
+		Width:    probe.Streams[0].Width,
+		Height:   probe.Streams[0].Height,
+	}, nil
+}
+
+// Poster returns the frame at the given second of the video at path as a
+// JPEG, extracted with ffmpeg which has to be on the PATH.
+func Poster(ctx context.Context, path string, at float64) ([]byte, error) {
+	return run(ctx, "ffmpeg",
+		"-v", "error",
+		"-ss", strconv.FormatFloat(at, 'f', 3, 64),
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	)
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}